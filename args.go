@@ -0,0 +1,1127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/thomasdesr/jsleep/jitter"
+)
+
+// argState is what parseArgs works out in one step and needs in a later
+// one, alongside the raw flag values.
+type argState struct {
+	fv        *flagValues
+	given     map[string]bool // long names of the flags that were given
+	durations jitter.DurationParser
+
+	cmdline  []string // every argument, for --base-file to resolve again
+	pos      []string // positional durations to sum into the base
+	specBase string   // the base from --spec, if any
+	// positionalJitter is a trailing positional percent, which with
+	// --percent-of becomes basePercent instead.
+	positionalJitter, basePercent string
+
+	untilSet, jitterSet, rangeSet, minSet, maxSet, plusMinusSet bool
+	// rangePercent is set when --range is a percent of the base.
+	rangePercent bool
+
+	jopts   jitter.Options
+	base    time.Duration
+	hasBase bool
+	// empiricalFlag is --dist-file or --choices, whichever lists the bases
+	// to pick from, or "" for neither.
+	empiricalFlag string
+	warmup        int // --warmup draws to discard once the interval is known
+}
+
+// parseArgs parses the command line into options. Each step checks and
+// resolves one group of flags, in an order that lets later steps rely on
+// earlier ones: the base and the interval around it come last.
+func parseArgs(args []string) (opts options, err error) {
+	fs := flag.NewFlagSet("jsleep", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = usage
+
+	p := argState{fv: new(flagValues), cmdline: args}
+	defs := flagDefs(&opts, p.fv)
+	for _, f := range defs {
+		f.define(fs)
+	}
+
+	// Everything after "--" is the command to run, passed through verbatim.
+	for i, arg := range args {
+		if arg == "--" {
+			args, opts.command = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	if p.pos, p.specBase, err = parseLayers(fs, &opts, p.fv, expandCounts(fs, args)); err != nil {
+		return
+	}
+	p.given = givenFlags(fs, defs)
+	fv := p.fv
+	p.untilSet, p.jitterSet, p.rangeSet = fv.untilStr != "", fv.jitterStr != "", fv.rangeStr != ""
+	p.minSet, p.maxSet = fv.minStr != "", fv.maxStr != ""
+	p.plusMinusSet = fv.plusStr != "" || fv.minusStr != ""
+
+	for _, step := range []func(*options, *argState) error{
+		splitPositional,
+		checkJitterFlags,
+		parseStyle,
+		parseRepeats,
+		parseModes,
+		parseSource,
+		parseDurationUnits,
+		parseChecks,
+		parseStops,
+		parseRounding,
+		parseJitterOptions,
+		resolveBase,
+		checkBaseRequirements,
+		resolveInterval,
+		checkZeroFloor,
+	} {
+		if err = step(&opts, &p); err != nil {
+			return
+		}
+	}
+	opts.base, opts.sampling = p.base, p.jopts
+
+	if p.warmup > 0 {
+		_, err = drawSamples(opts, p.warmup)
+	}
+	return
+}
+
+// parseLayers parses args with fs, over the config file and any --spec,
+// and returns the positional arguments and the base from --spec.
+func parseLayers(fs *flag.FlagSet, opts *options, fv *flagValues, args []string) (pos []string, specBase string, err error) {
+	if pos, err = parseFlags(fs, args); err != nil {
+		return
+	}
+
+	// Config file and --spec settings go in underneath the command line,
+	// the spec over the config file: load them, then parse the command line
+	// again so that it wins.
+	configPath, mustExist := fv.configStr, true
+	if configPath == "" {
+		configPath, mustExist = userConfigPath(), false
+	}
+	specPath := fv.specStr
+	if configPath != "" || specPath != "" {
+		// Each -v adds a level, so the second parse mustn't count them on
+		// top of the first; a level on the command line replaces the
+		// config file's.
+		opts.verbose = 0
+		if configPath != "" {
+			if err = loadConfig(fs, configPath, mustExist); err != nil {
+				return
+			}
+		}
+		if specPath != "" {
+			if specBase, err = loadSpec(fs, specPath); err != nil {
+				err = fmt.Errorf("--spec: %w", err)
+				return
+			}
+		}
+		configVerbose := opts.verbose
+		opts.verbose = 0
+		if pos, err = parseFlags(fs, args); err != nil {
+			return
+		}
+		if opts.verbose == 0 {
+			opts.verbose = configVerbose
+		}
+	}
+	return
+}
+
+// splitPositional sorts the positional arguments into the base and its
+// jitter, and checks them against the other ways of giving a base.
+func splitPositional(opts *options, p *argState) (err error) {
+	fv, given := p.fv, p.given
+	// Positional arguments are durations to sum into the base, optionally
+	// followed by a jitter percent. With --percent-of, that percent scales
+	// the reference duration into the base instead.
+	if n := len(p.pos); n > 0 && strings.HasSuffix(p.pos[n-1], "%") {
+		p.positionalJitter, p.pos = p.pos[n-1], p.pos[:n-1]
+	}
+	// A --spec base stands in for a missing positional duration, unless
+	// the command line picks the base some other way.
+	if p.specBase != "" && len(p.pos) == 0 && fv.untilStr == "" && fv.percentOfStr == "" && fv.baseFileStr == "" {
+		p.pos = []string{p.specBase}
+	}
+
+	if p.untilSet && len(p.pos) > 0 {
+		err = errors.New("cannot use --until with a positional duration")
+		return
+	}
+
+	if fv.percentOfStr != "" {
+		switch {
+		case p.untilSet:
+			err = errors.New("cannot use --percent-of with --until")
+		case len(p.pos) > 0:
+			err = errors.New("cannot use --percent-of with a positional duration")
+		case p.positionalJitter == "":
+			err = errors.New("--percent-of requires a positional percent")
+		}
+		if err != nil {
+			return
+		}
+		p.basePercent, p.positionalJitter = p.positionalJitter, ""
+	}
+
+	if fv.baseFileStr != "" {
+		switch {
+		case p.untilSet:
+			err = errors.New("cannot use --base-file with --until")
+		case fv.percentOfStr != "":
+			err = errors.New("cannot use --base-file with --percent-of")
+		case len(p.pos) > 0:
+			err = errors.New("cannot use --base-file with a positional duration")
+		}
+		if err != nil {
+			return
+		}
+		opts.baseFile, opts.baseArgs = fv.baseFileStr, p.cmdline
+	}
+	switch fv.onErrorStr {
+	case "fail":
+	case "skip":
+		opts.skipBaseErrors = true
+	default:
+		err = fmt.Errorf("invalid --on-error: %s (want fail or skip)", fv.onErrorStr)
+		return
+	}
+	if given["on-error"] && fv.baseFileStr == "" {
+		err = errors.New("--on-error requires --base-file")
+		return
+	}
+	return
+}
+
+// checkJitterFlags rejects combining the different ways of giving jitter.
+func checkJitterFlags(opts *options, p *argState) (err error) {
+	if p.jitterSet && p.rangeSet {
+		err = errors.New("cannot use --jitter with --range")
+		return
+	}
+	if p.positionalJitter != "" && p.jitterSet {
+		err = errors.New("cannot specify jitter both positionally and with --jitter")
+		return
+	}
+	if p.positionalJitter != "" && p.rangeSet {
+		err = errors.New("cannot use positional jitter with --range")
+		return
+	}
+	for _, c := range []struct {
+		set  bool
+		name string
+	}{
+		{p.jitterSet, "--jitter"},
+		{p.rangeSet, "--range"},
+		{p.positionalJitter != "", "positional jitter"},
+	} {
+		if p.plusMinusSet && c.set {
+			err = fmt.Errorf("cannot use --plus/--minus with %s", c.name)
+			return
+		}
+	}
+	return
+}
+
+// parseStyle checks the output style and distribution flags.
+func parseStyle(opts *options, p *argState) (err error) {
+	fv := p.fv
+	switch opts.durationFormat {
+	case "", "go", "ns", "human":
+	default:
+		err = fmt.Errorf("invalid --duration-format: %s (want go, ns, or human)", opts.durationFormat)
+		return
+	}
+
+	switch opts.color {
+	case "auto", "always", "never":
+	default:
+		err = fmt.Errorf("invalid --color: %s (want auto, always, or never)", opts.color)
+		return
+	}
+
+	switch fv.distStr {
+	case jitter.Uniform, jitter.Normal, jitter.Triangular, jitter.Exponential:
+		opts.dist = fv.distStr
+	default:
+		err = fmt.Errorf("unknown distribution: %s", fv.distStr)
+		return
+	}
+	return
+}
+
+// parseRepeats parses --count and --jobs, and rejects the options that
+// --jobs can't run alongside.
+func parseRepeats(opts *options, p *argState) (err error) {
+	fv, given := p.fv, p.given
+	if fv.countStr != "inf" {
+		if opts.count, err = strconv.Atoi(fv.countStr); err != nil || opts.count < 0 {
+			err = fmt.Errorf("invalid count: %s", fv.countStr)
+			return
+		}
+	}
+	if opts.stateFile != "" && opts.count != 1 {
+		err = errors.New("--state-file requires --count 1")
+		return
+	}
+
+	if opts.jobs, err = strconv.Atoi(fv.jobsStr); err != nil || opts.jobs < 1 {
+		err = fmt.Errorf("invalid jobs count: %s", fv.jobsStr)
+		return
+	}
+	if opts.jobs > 1 {
+		for _, c := range []struct {
+			set  bool
+			name string
+		}{
+			{given["count"], "--count"},
+			{fv.maxTotalStr != "", "--max-total"},
+			{opts.backoff, "--backoff"},
+			{opts.json, "--json"},
+			{opts.logFile != "", "--log-file"},
+			{opts.syslog, "--syslog"},
+			{opts.reportOnSignal, "--report-json-on-signal"},
+			{opts.metricsFile != "", "--metrics-file"},
+			{opts.stateFile != "", "--state-file"},
+			{opts.interactive, "--interactive"},
+			{fv.untilFileStr != "", "--until-file"},
+			{fv.waitTCPStr != "", "--wait-for-tcp"},
+			{fv.baseFileStr != "", "--base-file"},
+			{fv.probabilityStr != "", "--probability"},
+			{fv.deadlineStr != "", "--deadline"},
+			{fv.alignStr != "", "--align"},
+			{fv.pidWaitStr != "", "--pid-wait"},
+			{fv.exitBucketStr != "", "--exit-bucket"},
+			{opts.preExec != "", "--pre-exec"},
+			{opts.postExec != "", "--post-exec"},
+		} {
+			if c.set {
+				err = fmt.Errorf("cannot use --jobs with %s", c.name)
+				return
+			}
+		}
+	}
+	return
+}
+
+// parseModes checks the flags that pick what jsleep does instead of, or
+// around, a plain sleep.
+func parseModes(opts *options, p *argState) (err error) {
+	fv := p.fv
+	if opts.reportOnSignal && opts.ignoreSignals {
+		err = errors.New("cannot use --report-json-on-signal with --ignore-signals")
+		return
+	}
+	if opts.drain && opts.interactive {
+		err = errors.New("cannot use --drain with --interactive, which reads keys from stdin")
+		return
+	}
+	if opts.interactive && opts.ignoreSignals {
+		err = errors.New("cannot use --interactive with --ignore-signals, which would leave the terminal unrestored on Ctrl-C")
+		return
+	}
+
+	if fv.atStr != "" {
+		at, perr := jitter.ParsePercent(fv.atStr)
+		if perr != nil || at > 1 {
+			err = fmt.Errorf("invalid --at percentile: %s (want 0%% to 100%%)", fv.atStr)
+			return
+		}
+		opts.at = &at
+	}
+
+	opts.probability = 1
+	if fv.probabilityStr != "" {
+		if opts.probability, err = jitter.ParsePercent(fv.probabilityStr); err != nil || opts.probability > 1 {
+			err = fmt.Errorf("invalid probability: %s (want 0%% to 100%%)", fv.probabilityStr)
+			return
+		}
+	}
+
+	if fv.statsStr != "" {
+		if opts.stats, err = strconv.Atoi(fv.statsStr); err != nil || opts.stats <= 0 {
+			err = fmt.Errorf("invalid stats count: %s", fv.statsStr)
+			return
+		}
+	}
+
+	if fv.histStr != "" {
+		if fv.statsStr != "" {
+			err = errors.New("cannot use --stats with --hist")
+			return
+		}
+		if opts.hist, err = strconv.Atoi(fv.histStr); err != nil || opts.hist <= 0 {
+			err = fmt.Errorf("invalid hist count: %s", fv.histStr)
+			return
+		}
+	}
+
+	opts.backoffFactor, err = strconv.ParseFloat(fv.backoffFactorStr, 64)
+	if err != nil || opts.backoffFactor <= 0 || math.IsInf(opts.backoffFactor, 0) {
+		err = fmt.Errorf("invalid backoff factor: %s", fv.backoffFactorStr)
+		return
+	}
+	return
+}
+
+// parseSource sets up the random source from --rng, --seed and their
+// modifiers.
+func parseSource(opts *options, p *argState) (err error) {
+	fv, given := p.fv, p.given
+	// --seed-env stands in for --seed from here on.
+	if fv.seedEnvStr != "" {
+		if fv.seedStr != "" {
+			err = errors.New("cannot use --seed with --seed-env")
+			return
+		}
+		value := os.Getenv(fv.seedEnvStr)
+		if value == "" {
+			err = fmt.Errorf("--seed-env: $%s is not set", fv.seedEnvStr)
+			return
+		}
+		fv.seedStr = strconv.FormatUint(envSeed(value), 10)
+	}
+
+	// A seed alone keeps selecting math/rand, as it did before --rng.
+	if fv.rngStr == "" {
+		fv.rngStr = "crypto"
+		if fv.seedStr != "" {
+			fv.rngStr = "math"
+		}
+	}
+	if fv.warmupStr != "" {
+		if p.warmup, err = strconv.Atoi(fv.warmupStr); err != nil || p.warmup < 0 {
+			err = fmt.Errorf("invalid warmup count: %s", fv.warmupStr)
+			return
+		}
+		if fv.seedStr == "" {
+			err = errors.New("--warmup requires --seed")
+			return
+		}
+	}
+
+	var seed uint64
+	if fv.seedStr != "" {
+		if seed, err = strconv.ParseUint(fv.seedStr, 10, 64); err != nil {
+			err = fmt.Errorf("invalid seed: %s", fv.seedStr)
+			return
+		}
+	}
+	switch fv.rngStr {
+	case "crypto":
+		if fv.seedStr != "" {
+			err = errors.New("cannot use --seed with --rng crypto")
+			return
+		}
+	case "math", "pcg":
+		if fv.seedStr == "" {
+			seed = uint64(now().UnixNano())
+			opts.warnings = append(opts.warnings, fmt.Sprintf(
+				"--rng %s seeded from the clock with %d; pass --seed %d to repeat this run", fv.rngStr, seed, seed))
+		}
+	}
+	if opts.rand, err = newSource(fv.rngStr, seed); err != nil {
+		return
+	}
+	opts.rngName = fv.rngStr
+	var crypto jitter.CryptoSource
+	if given["rng-retries"] {
+		retries, perr := strconv.Atoi(fv.rngRetriesStr)
+		if perr != nil || retries < 1 {
+			err = fmt.Errorf("invalid rng retries: %s", fv.rngRetriesStr)
+			return
+		}
+		if fv.rngStr != "crypto" {
+			err = fmt.Errorf("cannot use --rng-retries with --rng %s", fv.rngStr)
+			return
+		}
+		crypto.Retries = retries
+		opts.rand = crypto
+	}
+	if fv.entropyFileStr != "" {
+		if fv.rngStr != "crypto" {
+			err = fmt.Errorf("cannot use --entropy-file with --rng %s", fv.rngStr)
+			return
+		}
+		var entropy []byte
+		if entropy, err = os.ReadFile(fv.entropyFileStr); err != nil {
+			err = fmt.Errorf("--entropy-file: %w", err)
+			return
+		}
+		crypto.Reader = &entropyReader{name: fv.entropyFileStr, r: bytes.NewReader(entropy)}
+		opts.rand = crypto
+	}
+	return
+}
+
+// parseDurationUnits sets up how duration flags and arguments are read.
+func parseDurationUnits(opts *options, p *argState) (err error) {
+	fv := p.fv
+	p.durations = jitter.DurationParser{
+		DefaultUnit:  os.Getenv("JSLEEP_DEFAULT_UNIT"),
+		StrictUnits:  fv.strictUnits,
+		DecimalComma: fv.decimalComma,
+	}
+	if fv.decimalComma && fv.choicesStr != "" {
+		err = errors.New("cannot use --decimal-comma with --choices, whose list is comma-separated")
+		return
+	}
+	if p.durations.DefaultUnit != "" {
+		if _, perr := p.durations.Parse("0"); perr != nil {
+			err = fmt.Errorf("JSLEEP_DEFAULT_UNIT: %w", perr)
+			return
+		}
+	}
+	return
+}
+
+// parseChecks parses the flags that check the chosen duration or say where
+// and how to report it.
+func parseChecks(opts *options, p *argState) (err error) {
+	fv, durations := p.fv, p.durations
+	if fv.warnAboveStr != "" {
+		if opts.warnAbove, err = durations.Parse(fv.warnAboveStr); err != nil {
+			return
+		}
+		if opts.warnAbove <= 0 {
+			err = errors.New("--warn-above must be positive")
+			return
+		}
+	} else if opts.strict && fv.maxStr == "" {
+		err = errors.New("--strict requires --warn-above or --max")
+		return
+	}
+
+	switch fv.pidModeStr {
+	case pidLater, pidEarlier:
+		opts.pidMode = fv.pidModeStr
+	default:
+		err = fmt.Errorf("unknown pid mode: %s (want later or earlier)", fv.pidModeStr)
+		return
+	}
+	if fv.pidWaitStr != "" {
+		if opts.pidWait, err = strconv.Atoi(fv.pidWaitStr); err != nil || opts.pidWait < 1 {
+			err = fmt.Errorf("invalid pid: %s", fv.pidWaitStr)
+			return
+		}
+		if err = checkProcess(opts.pidWait); err != nil {
+			err = fmt.Errorf("--pid-wait: %w", err)
+			return
+		}
+	} else if fv.pidModeStr != pidLater {
+		err = errors.New("--pid-mode requires --pid-wait")
+		return
+	}
+
+	if fv.outputFDStr != "" {
+		if opts.outputFD, err = strconv.Atoi(fv.outputFDStr); err != nil || opts.outputFD < 1 {
+			err = fmt.Errorf("invalid --output-fd: %s", fv.outputFDStr)
+			return
+		}
+	}
+
+	if fv.formatStr != "" {
+		if opts.format, err = template.New("format").Parse(fv.formatStr); err != nil {
+			err = fmt.Errorf("invalid --format: %w", err)
+			return
+		}
+		// Catch references to fields that don't exist now, not after the
+		// first sleep.
+		if err = opts.format.Execute(io.Discard, formatFields{}); err != nil {
+			err = fmt.Errorf("invalid --format: %w", err)
+			return
+		}
+	}
+
+	if fv.exitBucketStr != "" {
+		// maxExitBuckets keeps exitBucketBase+n below the 126 and up
+		// that shells reserve.
+		if opts.exitBucket, err = strconv.Atoi(fv.exitBucketStr); err != nil || opts.exitBucket < 1 || opts.exitBucket > maxExitBuckets {
+			err = fmt.Errorf("invalid exit bucket count: %s (want 1 to %d)", fv.exitBucketStr, maxExitBuckets)
+			return
+		}
+		if len(opts.command) > 0 {
+			err = errors.New("cannot use --exit-bucket with a command, whose exit status replaces jsleep's")
+			return
+		}
+	}
+	return
+}
+
+// parseStops parses the flags that end the sleeping early or keep it
+// looping until something happens.
+func parseStops(opts *options, p *argState) (err error) {
+	fv, given, durations := p.fv, p.given, p.durations
+	if fv.deadlineStr != "" {
+		// Unlike --until, a clock time that has passed today is not moved
+		// to tomorrow: the deadline is simply over.
+		if opts.deadline, _, err = parseWallTime(fv.deadlineStr, now(), durations); err != nil {
+			return
+		}
+	}
+
+	if fv.untilFileStr != "" {
+		opts.untilFile = fv.untilFileStr
+		if !given["count"] {
+			opts.count = 0
+		}
+	}
+	if fv.waitTCPStr != "" {
+		if opts.untilFile != "" {
+			err = errors.New("cannot use --wait-for-tcp with --until-file")
+			return
+		}
+		if _, _, serr := net.SplitHostPort(fv.waitTCPStr); serr != nil {
+			err = fmt.Errorf("invalid --wait-for-tcp address: %w", serr)
+			return
+		}
+		opts.waitTCP = fv.waitTCPStr
+		if !given["count"] {
+			opts.count = 0
+		}
+	}
+	if fv.timeoutStr != "" {
+		if opts.untilFile == "" && opts.waitTCP == "" {
+			err = errors.New("--timeout requires --until-file or --wait-for-tcp")
+			return
+		}
+		var timeout time.Duration
+		if timeout, err = durations.Parse(fv.timeoutStr); err != nil {
+			return
+		}
+		if timeout <= 0 {
+			err = errors.New("--timeout must be positive")
+			return
+		}
+		// The timeout is a deadline that ends in failure.
+		if t := now().Add(timeout); opts.deadline.IsZero() || t.Before(opts.deadline) {
+			opts.deadline = t
+		}
+	}
+
+	if opts.explain {
+		if len(opts.command) == 0 {
+			err = errors.New("--explain requires a command after --")
+			return
+		}
+		opts.dryRun = true
+	}
+
+	if given["ci-env"] && !fv.skipIfCI {
+		err = errors.New("--ci-env requires --skip-if-ci")
+		return
+	}
+	if fv.skipIfCI {
+		if opts.ciVar = ciVar(fv.ciEnvStr); opts.ciVar != "" {
+			opts.dryRun = true
+		}
+	}
+
+	if fv.maxTotalStr != "" {
+		if opts.maxTotal, err = durations.Parse(fv.maxTotalStr); err != nil {
+			return
+		}
+		if opts.maxTotal <= 0 {
+			err = errors.New("max total must be positive")
+			return
+		}
+	}
+	return
+}
+
+// parseRounding parses the flags that adjust the chosen duration.
+func parseRounding(opts *options, p *argState) (err error) {
+	fv, durations := p.fv, p.durations
+	var roundSrc string
+	for _, r := range []struct{ mode, val string }{{"round", fv.roundStr}, {"floor", fv.floorStr}, {"ceil", fv.ceilStr}, {"quantize", fv.quantizeStr}} {
+		if r.val == "" {
+			continue
+		}
+		if opts.roundMode != "" {
+			err = fmt.Errorf("cannot use --%s with --%s", opts.roundMode, r.mode)
+			return
+		}
+		opts.roundMode, roundSrc = r.mode, r.val
+	}
+	if opts.roundMode != "" {
+		if opts.roundUnit, err = durations.Parse(roundSrc); err != nil {
+			return
+		}
+		if opts.roundUnit <= 0 {
+			err = fmt.Errorf("--%s unit must be positive", opts.roundMode)
+			return
+		}
+	}
+
+	if fv.alignStr != "" {
+		if opts.align, err = durations.Parse(fv.alignStr); err != nil {
+			return
+		}
+		if opts.align <= 0 {
+			err = errors.New("--align unit must be positive")
+			return
+		}
+	}
+
+	if fv.minSleepStr != "" {
+		if opts.minSleep, err = durations.Parse(fv.minSleepStr); err != nil {
+			return
+		}
+		if opts.minSleep < 0 {
+			err = errors.New("--min-sleep cannot be negative")
+			return
+		}
+	}
+	return
+}
+
+// parseJitterOptions parses the flags that shape the interval into
+// p.jopts, leaving what depends on the base to resolveInterval.
+func parseJitterOptions(opts *options, p *argState) (err error) {
+	fv, durations := p.fv, p.durations
+	switch fv.clampModeStr {
+	case jitter.Clip, jitter.Shift:
+	default:
+		err = fmt.Errorf("unknown clamp mode: %s", fv.clampModeStr)
+		return
+	}
+
+	switch fv.jitterModeStr {
+	case jitter.Additive:
+	case jitter.Multiplicative:
+		if p.rangeSet || p.plusMinusSet {
+			err = errors.New("cannot use --jitter-mode multiplicative with --range or --plus/--minus")
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown jitter mode: %s (want additive or multiplicative)", fv.jitterModeStr)
+		return
+	}
+
+	p.jopts = jitter.Options{Dist: opts.dist, Source: opts.rand, ClampMode: fv.clampModeStr, JitterMode: fv.jitterModeStr}
+	// A percent range depends on the base, so baseInterval resolves it.
+	p.rangePercent = strings.HasSuffix(fv.rangeStr, "%")
+	if p.rangeSet && !p.rangePercent {
+		if p.jopts.Range, err = durations.Parse(fv.rangeStr); err != nil {
+			return
+		}
+		if p.jopts.Range < 0 {
+			err = fmt.Errorf("range cannot be negative: %s (it already extends both ways; use --range %s for ±%s)",
+				fv.rangeStr, -p.jopts.Range, -p.jopts.Range)
+			return
+		}
+	}
+	for _, f := range []struct {
+		s    string
+		name string
+		d    *time.Duration
+	}{
+		{fv.plusStr, "--plus", &p.jopts.Plus},
+		{fv.minusStr, "--minus", &p.jopts.Minus},
+	} {
+		if f.s == "" {
+			continue
+		}
+		if *f.d, err = durations.Parse(f.s); err != nil {
+			return
+		}
+		if *f.d < 0 {
+			err = fmt.Errorf("%s cannot be negative: %s", f.name, f.s)
+			return
+		}
+	}
+	if fv.offsetStr != "" {
+		if p.jopts.Offset, err = durations.Parse(fv.offsetStr); err != nil {
+			return
+		}
+	}
+	if fv.jitterCapStr != "" {
+		if p.jopts.MaxDelta, err = durations.Parse(fv.jitterCapStr); err != nil {
+			return
+		}
+		if p.jopts.MaxDelta <= 0 {
+			err = errors.New("--jitter-cap must be positive")
+			return
+		}
+		if p.rangeSet || p.plusMinusSet {
+			err = errors.New("cannot use --jitter-cap with --range or --plus/--minus, which are absolute already")
+			return
+		}
+	}
+	if fv.capWidthStr != "" {
+		if p.jopts.MaxWidth, err = durations.Parse(fv.capWidthStr); err != nil {
+			return
+		}
+		if p.jopts.MaxWidth <= 0 {
+			err = errors.New("--cap-width must be positive")
+			return
+		}
+	}
+	if p.minSet {
+		var minVal time.Duration
+		if minVal, err = durations.Parse(fv.minStr); err != nil {
+			return
+		}
+		p.jopts.Min = &minVal
+	}
+	if p.maxSet {
+		var maxVal time.Duration
+		if maxVal, err = durations.Parse(fv.maxStr); err != nil {
+			return
+		}
+		p.jopts.Max = &maxVal
+	}
+	return
+}
+
+// resolveBase works out the base duration, if the command line gives one.
+func resolveBase(opts *options, p *argState) (err error) {
+	fv, durations := p.fv, p.durations
+	if p.untilSet {
+		if p.base, err = parseUntil(fv.untilStr, now(), durations); err != nil {
+			return
+		}
+		p.hasBase = true
+	} else if fv.percentOfStr != "" {
+		var ref time.Duration
+		if ref, err = durations.Parse(fv.percentOfStr); err != nil {
+			return
+		}
+		if ref < 0 {
+			err = fmt.Errorf("--percent-of must be non-negative: %s", ref)
+			return
+		}
+		var frac float64
+		if frac, err = jitter.ParsePercent(p.basePercent); err != nil {
+			err = fmt.Errorf("invalid base percent: %s", p.basePercent)
+			return
+		}
+		b := math.Round(float64(ref) * frac)
+		if b >= math.MaxInt64 {
+			err = fmt.Errorf("base out of range: %s of %s", p.basePercent, fv.percentOfStr)
+			return
+		}
+		p.base, p.hasBase = time.Duration(b), true
+	} else if fv.baseFileStr != "" {
+		if p.base, err = readBaseFile(fv.baseFileStr, durations); err != nil {
+			return
+		}
+		p.hasBase = true
+	} else if len(p.pos) > 0 {
+		if p.base, err = sumDurations(p.pos, durations); err != nil {
+			return
+		}
+		if p.base < 0 {
+			if !fv.clampNegative {
+				err = fmt.Errorf("base duration must be non-negative: %s (--clamp-negative treats it as 0)", p.base)
+				return
+			}
+			p.base = 0
+		}
+		p.hasBase = true
+	}
+	return
+}
+
+// checkBaseRequirements rejects flags that need a base when there is
+// none, or that don't fit the base that was given.
+func checkBaseRequirements(opts *options, p *argState) (err error) {
+	fv := p.fv
+	if p.positionalJitter != "" && !p.hasBase {
+		err = errors.New("positional jitter requires a base duration")
+		return
+	}
+
+	if opts.backoff && !p.hasBase {
+		err = errors.New("--backoff requires a base duration")
+		return
+	}
+
+	// --dist-file and --choices both list the bases to pick from.
+	switch {
+	case fv.distFileStr != "" && fv.choicesStr != "":
+		err = errors.New("cannot use --choices with --dist-file")
+		return
+	case fv.distFileStr != "":
+		p.empiricalFlag = "--dist-file"
+	case fv.choicesStr != "":
+		p.empiricalFlag = "--choices"
+	}
+	empiricalSet := p.empiricalFlag != ""
+
+	if fv.fixed && !p.hasBase && !empiricalSet {
+		err = errors.New("--fixed requires a base duration")
+		return
+	}
+
+	if empiricalSet {
+		if p.hasBase {
+			err = fmt.Errorf("cannot use %s with a base duration", p.empiricalFlag)
+			return
+		}
+		if opts.backoff {
+			err = fmt.Errorf("cannot use %s with --backoff", p.empiricalFlag)
+			return
+		}
+	}
+
+	for _, c := range []struct {
+		set, conflict bool
+		name, other   string
+	}{
+		{fv.floorPercentStr != "", p.minSet, "--floor-percent", "--min"},
+		{fv.ceilPercentStr != "", p.maxSet, "--ceil-percent", "--max"},
+	} {
+		switch {
+		case !c.set:
+		case c.conflict:
+			err = fmt.Errorf("cannot use %s with %s", c.name, c.other)
+		case !p.hasBase || empiricalSet:
+			err = fmt.Errorf("%s requires a base duration", c.name)
+		case opts.backoff:
+			err = fmt.Errorf("cannot use %s with --backoff", c.name)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	if fv.offsetStr != "" && !p.hasBase && !empiricalSet {
+		err = errors.New("--offset requires a base duration")
+		return
+	}
+	if fv.jitterCapStr != "" && !p.hasBase && !empiricalSet {
+		err = errors.New("--jitter-cap requires a base duration")
+		return
+	}
+	if fv.capWidthStr != "" && !p.hasBase && !empiricalSet {
+		err = errors.New("--cap-width requires a base duration")
+		return
+	}
+	if p.plusMinusSet && (!p.hasBase || empiricalSet) {
+		err = errors.New("--plus/--minus require a base duration")
+		return
+	}
+	if p.jopts.Minus > p.base {
+		err = fmt.Errorf("--minus %s is more than the base %s", p.jopts.Minus, p.base)
+		return
+	}
+
+	// Exponential draws have the base as their mean and a long upper tail, so
+	// their interval has to come from percent jitter around a base: a
+	// symmetric --range would cut the tail off, and --min and --max alone
+	// leave no mean to draw around. Uniform, normal, and triangular shape
+	// any interval.
+	if opts.dist == jitter.Exponential && (p.rangeSet || p.plusMinusSet || (!p.hasBase && !empiricalSet && (p.minSet || p.maxSet))) {
+		err = errors.New("cannot use --dist exponential with --range, --plus/--minus, or --min/--max alone; give a base duration with percent jitter, optionally clamped by --min/--max")
+		return
+	}
+	return
+}
+
+// resolveInterval works out the interval to sample from.
+func resolveInterval(opts *options, p *argState) (err error) {
+	switch {
+	case p.empiricalFlag != "":
+		return empiricalInterval(opts, p)
+	case p.rangeSet && !p.hasBase:
+		return errors.New("--range requires a base duration")
+	case p.hasBase:
+		return baseInterval(opts, p)
+	case p.minSet && p.maxSet:
+		opts.low, opts.high, err = jitter.Clamp(*p.jopts.Min, *p.jopts.Max, p.jopts)
+		opts.unclampedLow, opts.unclampedHigh = *p.jopts.Min, *p.jopts.Max
+		p.base = opts.low + (opts.high-opts.low)/2
+		opts.jitterFrom = "--min/--max"
+		return err
+	default:
+		return errors.New("missing required duration")
+	}
+}
+
+// empiricalInterval covers every duration from --dist-file or --choices,
+// jittered only on request.
+func empiricalInterval(opts *options, p *argState) (err error) {
+	fv, durations := p.fv, p.durations
+	if fv.distFileStr != "" {
+		opts.empirical, err = readDurationFile(fv.distFileStr, durations)
+	} else {
+		opts.empirical, err = parseChoices(fv.choicesStr, durations)
+	}
+	if err != nil {
+		return
+	}
+	// Picked durations are only jittered on request.
+	opts.jitterFrom = p.empiricalFlag
+	switch {
+	case fv.fixed:
+		opts.jitterFrom = "--fixed"
+	case p.rangeSet:
+		opts.jitterFrom = "--range"
+		if !p.rangePercent {
+			break
+		}
+		if p.jopts.Down, err = jitter.ParsePercent(fv.rangeStr); err != nil {
+			return
+		}
+		p.jopts.Up = p.jopts.Down
+	case p.jitterSet:
+		opts.jitterFrom = "--jitter"
+		if p.jopts.Down, p.jopts.Up, err = jitter.ParseJitter(fv.jitterStr); err != nil {
+			return
+		}
+	}
+	if opts.unclampedLow, _, err = jitter.Interval(slices.Min(opts.empirical), p.jopts); err != nil {
+		return
+	}
+	if _, opts.unclampedHigh, err = jitter.Interval(slices.Max(opts.empirical), p.jopts); err != nil {
+		return
+	}
+	if opts.low, _, err = jitter.Bounds(slices.Min(opts.empirical), p.jopts); err != nil {
+		return
+	}
+	_, opts.high, err = jitter.Bounds(slices.Max(opts.empirical), p.jopts)
+	return
+}
+
+// baseInterval puts the interval around the base, with jitter from the
+// first of --fixed, --plus/--minus, --range, --jitter, a positional
+// percent, and $JSLEEP_JITTER.
+func baseInterval(opts *options, p *argState) (err error) {
+	fv := p.fv
+	switch {
+	case fv.fixed:
+		// --fixed beats every other source of jitter.
+		p.jopts.Down, p.jopts.Up, p.jopts.Range, p.jopts.Minus, p.jopts.Plus = 0, 0, 0, 0, 0
+		opts.jitterFrom = "--fixed"
+	case p.plusMinusSet:
+		opts.jitterFrom = "--plus/--minus"
+	case p.rangeSet:
+		opts.jitterFrom = "--range"
+		if !p.rangePercent {
+			break
+		}
+		var frac float64
+		if frac, err = jitter.ParsePercent(fv.rangeStr); err != nil {
+			return
+		}
+		r := float64(p.base) * frac
+		if r >= math.MaxInt64 {
+			err = fmt.Errorf("range out of range: %s", fv.rangeStr)
+			return
+		}
+		p.jopts.Range = time.Duration(r)
+	default:
+		opts.jitterFrom = "default"
+		p.jopts.Down, p.jopts.Up = jitter.DefaultFraction, jitter.DefaultFraction
+		if opts.dist == jitter.Exponential {
+			// Exponential draws stray far from their mean, so by default
+			// allow [0, 10x the mean], which clips about 1 in 22000.
+			p.jopts.Down, p.jopts.Up = 1, 9
+		}
+		if p.jitterSet {
+			opts.jitterFrom = "--jitter"
+			if p.jopts.Down, p.jopts.Up, err = jitter.ParseJitter(fv.jitterStr); err != nil {
+				return
+			}
+		} else if p.positionalJitter != "" {
+			opts.jitterFrom = "positional"
+			if p.jopts.Down, p.jopts.Up, err = jitter.ParseJitter(p.positionalJitter); err != nil {
+				return
+			}
+		} else if env := os.Getenv("JSLEEP_JITTER"); env != "" {
+			opts.jitterFrom = "JSLEEP_JITTER"
+			if p.jopts.Down, p.jopts.Up, err = jitter.ParseJitter(env); err != nil {
+				err = fmt.Errorf("JSLEEP_JITTER: %w", err)
+				return
+			}
+		}
+	}
+
+	// --floor-percent and --ceil-percent are --min and --max relative
+	// to the base.
+	if fv.floorPercentStr != "" {
+		if p.jopts.Min, err = percentOfBase(p.base, fv.floorPercentStr); err != nil {
+			err = fmt.Errorf("invalid --floor-percent: %w", err)
+			return
+		}
+	}
+	if fv.ceilPercentStr != "" {
+		if p.jopts.Max, err = percentOfBase(p.base, fv.ceilPercentStr); err != nil {
+			err = fmt.Errorf("invalid --ceil-percent: %w", err)
+			return
+		}
+	}
+
+	var low, high time.Duration
+	if low, high, err = jitter.Interval(p.base, p.jopts); err != nil {
+		return
+	}
+	if low < 0 && !fv.allowZeroFloor && !fv.noClampZero {
+		opts.warnings = append(opts.warnings, fmt.Sprintf(
+			"jitter puts the low end at %s; flooring it at 0 skews the distribution toward 0 (--allow-zero-floor silences this)", low))
+	}
+	if opts.low, opts.high, err = jitter.Clamp(low, high, p.jopts); err != nil {
+		return
+	}
+	opts.unclampedLow, opts.unclampedHigh = low, high
+	if fv.fixed && opts.low != low {
+		err = fmt.Errorf("--min/--max move the --fixed duration from %s to %s", low, opts.low)
+		return
+	}
+	// A --max below the base cuts off the whole upper half of the
+	// interval, which is more likely a unit mistake than intended.
+	// Otherwise catch --min/--max squeezing out the jitter, which is
+	// easy to do by accident and otherwise invisible.
+	if p.maxSet && *p.jopts.Max < p.base+p.jopts.Offset {
+		msg := fmt.Sprintf("--max %s is below the base duration %s, so no sleep runs past %s; check for a unit mistake", *p.jopts.Max, p.base+p.jopts.Offset, opts.high)
+		if opts.strict {
+			err = errors.New(msg)
+			return
+		}
+		opts.warnings = append(opts.warnings, msg)
+	} else if (p.minSet || p.maxSet) && high > low && opts.high-opts.low <= (high-low)/100 {
+		if opts.high == opts.low {
+			opts.warnings = append(opts.warnings, fmt.Sprintf(
+				"--min/--max clamp the interval to a single point (%s), so no jitter is applied", opts.low))
+		} else {
+			opts.warnings = append(opts.warnings, fmt.Sprintf(
+				"--min/--max clamp the interval to [%s, %s], leaving almost no jitter", opts.low, opts.high))
+		}
+	}
+	return
+}
+
+// checkZeroFloor enforces --no-clamp-zero.
+func checkZeroFloor(opts *options, p *argState) (err error) {
+	fv := p.fv
+	if fv.noClampZero && fv.allowZeroFloor {
+		err = errors.New("cannot use --no-clamp-zero with --allow-zero-floor")
+		return
+	}
+	if fv.noClampZero && opts.unclampedLow < 0 {
+		err = fmt.Errorf("interval [%s, %s] reaches below zero (--no-clamp-zero)", opts.unclampedLow, opts.unclampedHigh)
+		return
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/thomasdesr/jsleep/jitter"
+)
+
+// benchBatch is how many draws runBenchRNG makes between clock reads, so
+// reading the clock doesn't dominate fast generators.
+const benchBatch = 1024
+
+// runBenchRNG implements "jsleep bench-rng": it draws from the selected --rng
+// generator for --duration through the same Source interface sampling uses,
+// and prints the rate as "rng=<name> draws_per_sec=<n>".
+func runBenchRNG(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bench-rng", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	name := fs.String("rng", "crypto", "")
+	durationStr := fs.String("duration", "1s", "")
+	if err := fs.Parse(args); err != nil {
+		return usageError{fmt.Errorf("bench-rng: %w", err)}
+	}
+	if fs.NArg() > 0 {
+		return usageError{errors.New("usage: jsleep bench-rng [--rng <name>] [--duration <duration>]")}
+	}
+	d, err := jitter.ParseDuration(*durationStr)
+	if err != nil || d <= 0 {
+		return usageError{fmt.Errorf("bench-rng: invalid duration: %s", *durationStr)}
+	}
+	src, err := newSource(*name, uint64(now().UnixNano()))
+	if err != nil {
+		return usageError{fmt.Errorf("bench-rng: %w", err)}
+	}
+
+	var draws int
+	var elapsed time.Duration
+	start := time.Now()
+	for elapsed < d {
+		for range benchBatch {
+			// An hour in nanoseconds stands in for a typical interval width.
+			if _, err := src.Uint64n(uint64(time.Hour)); err != nil {
+				return err
+			}
+		}
+		draws += benchBatch
+		elapsed = time.Since(start)
+	}
+	fmt.Fprintf(stdout, "rng=%s draws_per_sec=%.0f\n", *name, float64(draws)/elapsed.Seconds())
+	return nil
+}
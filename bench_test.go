@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunBenchRNG(t *testing.T) {
+	for _, name := range []string{"crypto", "math", "pcg"} {
+		t.Run(name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := run([]string{"bench-rng", "--rng", name, "--duration", "10ms"}, &stdout, new(bytes.Buffer)); err != nil {
+				t.Fatal(err)
+			}
+			rate, ok := strings.CutPrefix(strings.TrimSpace(stdout.String()), "rng="+name+" draws_per_sec=")
+			if !ok {
+				t.Fatalf("unexpected output: %q", stdout.String())
+			}
+			if n, err := strconv.ParseFloat(rate, 64); err != nil || n <= 0 {
+				t.Errorf("draws_per_sec = %q, want a positive number", rate)
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"bench-rng", "--rng", "dice"},
+		{"bench-rng", "--duration", "0s"},
+		{"bench-rng", "--duration", "soon"},
+		{"bench-rng", "10s"},
+		{"bench-rng", "--bogus"},
+	} {
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); exitCode(err) != exitUsage {
+			t.Errorf("run(%v) = %v, want a usage error", args, err)
+		}
+	}
+}
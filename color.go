@@ -0,0 +1,45 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// writerIsTerminal reports whether w is a terminal, swapped out in tests.
+var writerIsTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isTerminal(f)
+}
+
+// useColor decides whether output to w gets ANSI colors under mode, which is
+// "auto", "always", or "never". In auto mode only terminals are colored, and
+// only when NO_COLOR is unset.
+func useColor(mode string, w io.Writer) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	default:
+		return os.Getenv("NO_COLOR") == "" && writerIsTerminal(w)
+	}
+}
+
+// palette styles text with ANSI escapes, or passes it through untouched when
+// color is off.
+type palette struct {
+	enabled bool
+}
+
+func (p palette) style(code, s string) string {
+	if !p.enabled {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+// dim is for labels.
+func (p palette) dim(s string) string { return p.style("2", s) }
+
+// bright is for the values that matter.
+func (p palette) bright(s string) string { return p.style("1", s) }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeTerminal makes every writer look like a terminal, or not, for the
+// rest of the test.
+func fakeTerminal(t *testing.T, terminal bool) {
+	t.Helper()
+	orig := writerIsTerminal
+	writerIsTerminal = func(io.Writer) bool { return terminal }
+	t.Cleanup(func() { writerIsTerminal = orig })
+}
+
+func TestUseColor(t *testing.T) {
+	var buf bytes.Buffer
+	tests := []struct {
+		mode     string
+		terminal bool
+		noColor  string
+		want     bool
+	}{
+		{"auto", false, "", false},
+		{"auto", true, "", true},
+		{"auto", true, "1", false},
+		{"always", false, "1", true},
+		{"never", true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			fakeTerminal(t, tt.terminal)
+			if got := useColor(tt.mode, &buf); got != tt.want {
+				t.Errorf("useColor(%q) with terminal=%v NO_COLOR=%q = %v, want %v", tt.mode, tt.terminal, tt.noColor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	fakeTerminal(t, true)
+
+	tests := []struct {
+		args      []string
+		wantColor bool
+	}{
+		{[]string{"-n", "10s"}, true},
+		{[]string{"-n", "--color", "always", "10s"}, true},
+		{[]string{"-n", "--color", "never", "10s"}, false},
+	}
+
+	for _, tt := range tests {
+		var stdout, stderr bytes.Buffer
+		if err := run(tt.args, &stdout, &stderr); err != nil {
+			t.Fatalf("run(%v): %v", tt.args, err)
+		}
+		if got := strings.Contains(stderr.String(), "\033["); got != tt.wantColor {
+			t.Errorf("run(%v) colored = %v, want %v: %q", tt.args, got, tt.wantColor, stderr.String())
+		}
+		if got := stripANSI(stderr.String()); !strings.HasPrefix(got, "sleeping for ") {
+			t.Errorf("run(%v) = %q, want the plain text to start with %q", tt.args, got, "sleeping for ")
+		}
+	}
+
+	if _, err := parseArgs([]string{"--color", "sometimes", "10s"}); err == nil {
+		t.Error("parseArgs accepted --color sometimes")
+	}
+}
+
+// stripANSI removes the escapes palette adds.
+func stripANSI(s string) string {
+	for _, code := range []string{"\033[0m", "\033[1m", "\033[2m"} {
+		s = strings.ReplaceAll(s, code, "")
+	}
+	return s
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// subcommands are the words jsleep accepts in place of its first argument.
+var subcommands = []string{"sample", "stream", "cron", "completion", "bench-rng"}
+
+// completionShells are the shells "jsleep completion" writes scripts for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionUnits are the suffixes suggested after a bare number.
+var completionUnits = []string{"ns", "us", "ms", "s", "m", "h", "d", "w"}
+
+// runCompletion implements "jsleep completion <shell>": it prints a script
+// to stdout that completes jsleep's flags, subcommands, and duration units.
+func runCompletion(args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return usageError{errors.New("usage: jsleep completion <bash|zsh|fish>")}
+	}
+	defs := flagDefs(new(options), new(flagValues))
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(stdout, defs)
+	case "zsh":
+		writeZshCompletion(stdout, defs)
+	case "fish":
+		writeFishCompletion(stdout, defs)
+	default:
+		return usageError{fmt.Errorf("completion: unknown shell: %s (want bash, zsh, or fish)", args[0])}
+	}
+	return nil
+}
+
+// flagNames returns every spelling of the flags in defs: "--long" and, if
+// there is one, "-s".
+func flagNames(defs []flagDef) []string {
+	var names []string
+	for _, f := range defs {
+		names = append(names, "--"+f.long)
+		if f.short != "" {
+			names = append(names, "-"+f.short)
+		}
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, defs []flagDef) {
+	fmt.Fprintf(w, `# bash completion for jsleep. Load it with:
+#   source <(jsleep completion bash)
+_jsleep() {
+	local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}
+	if [[ $prev == completion ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		return
+	fi
+	case $cur in
+	-*)
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		;;
+	*[0-9])
+		COMPREPLY=($(compgen -P "$cur" -W "%s"))
+		;;
+	*)
+		if ((COMP_CWORD == 1)); then
+			COMPREPLY=($(compgen -W "%s" -- "$cur"))
+		fi
+		;;
+	esac
+}
+complete -o default -F _jsleep jsleep
+`,
+		strings.Join(completionShells, " "),
+		strings.Join(flagNames(defs), " "),
+		strings.Join(completionUnits, " "),
+		strings.Join(subcommands, " "))
+}
+
+func writeZshCompletion(w io.Writer, defs []flagDef) {
+	var flags []string
+	for _, f := range defs {
+		desc := strings.ReplaceAll(f.usage, ":", `\:`)
+		flags = append(flags, zshQuote("--"+f.long+":"+desc))
+		if f.short != "" {
+			flags = append(flags, zshQuote("-"+f.short+":"+desc))
+		}
+	}
+	fmt.Fprintf(w, `#compdef jsleep
+# zsh completion for jsleep. Save it as _jsleep in a directory on $fpath, or
+# load it with:
+#   source <(jsleep completion zsh)
+_jsleep() {
+	local -a flags units
+	flags=(
+		%s
+	)
+	units=(%s)
+	if [[ ${words[CURRENT-1]} == completion ]]; then
+		compadd -- %s
+	elif [[ $PREFIX == -* ]]; then
+		_describe option flags
+	elif [[ $PREFIX == *[0-9] ]]; then
+		compadd -- "${units[@]/#/$PREFIX}"
+	elif ((CURRENT == 2)); then
+		compadd -- %s
+		_files
+	else
+		_files
+	fi
+}
+compdef _jsleep jsleep
+`,
+		strings.Join(flags, "\n\t\t"),
+		strings.Join(completionUnits, " "),
+		strings.Join(completionShells, " "),
+		strings.Join(subcommands, " "))
+}
+
+func writeFishCompletion(w io.Writer, defs []flagDef) {
+	fmt.Fprintln(w, "# fish completion for jsleep. Load it with:")
+	fmt.Fprintln(w, "#   jsleep completion fish | source")
+	for _, f := range defs {
+		line := "complete -c jsleep -l " + f.long
+		if f.short != "" {
+			line += " -s " + f.short
+		}
+		if f.takesValue() {
+			line += " -r"
+		}
+		fmt.Fprintf(w, "%s -d %s\n", line, fishQuote(f.usage))
+	}
+	fmt.Fprintf(w, "complete -c jsleep -n __fish_use_subcommand -a %s\n", fishQuote(strings.Join(subcommands, " ")))
+	fmt.Fprintf(w, "complete -c jsleep -n '__fish_seen_subcommand_from completion' -f -a %s\n", fishQuote(strings.Join(completionShells, " ")))
+	fmt.Fprintf(w, "complete -c jsleep -a '(string match -qr %s -- (commandline -ct); and printf %s (commandline -ct){%s})'\n",
+		`"[0-9]\$"`, `"%s\n"`, strings.Join(completionUnits, ","))
+}
+
+// zshQuote single-quotes s for zsh.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote single-quotes s for fish, which allows \' and \\ inside.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
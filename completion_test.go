@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunCompletion(t *testing.T) {
+	defs := flagDefs(new(options), new(flagValues))
+
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := run([]string{"completion", shell}, &stdout, new(bytes.Buffer)); err != nil {
+				t.Fatalf("completion %s: %v", shell, err)
+			}
+			script := stdout.String()
+			for _, f := range defs {
+				if !strings.Contains(script, f.long) {
+					t.Errorf("completion %s is missing --%s", shell, f.long)
+				}
+			}
+			for _, word := range slices.Concat(subcommands, completionUnits) {
+				if !strings.Contains(script, word) {
+					t.Errorf("completion %s is missing %q", shell, word)
+				}
+			}
+		})
+	}
+
+	t.Run("bash lists every spelling", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if err := run([]string{"completion", "bash"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatal(err)
+		}
+		words := strings.Fields(strings.NewReplacer(`"`, " ", "(", " ", ")", " ").Replace(stdout.String()))
+		have := make(map[string]bool)
+		for _, w := range words {
+			have[w] = true
+		}
+		for _, name := range flagNames(defs) {
+			if !have[name] {
+				t.Errorf("bash completion is missing %s", name)
+			}
+		}
+	})
+
+	for _, args := range [][]string{{"completion"}, {"completion", "tcsh"}, {"completion", "bash", "zsh"}} {
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); exitCode(err) != exitUsage {
+			t.Errorf("run(%v) = %v, want a usage error", args, err)
+		}
+	}
+}
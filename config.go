@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// userConfigPath returns the config file loaded when --config isn't given,
+// or "" if there is no home directory to look in.
+func userConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "jsleep", "config")
+}
+
+// loadConfig sets flags in set from the config file at path. Each line is a
+// flag name and its value separated by "=", as in "jitter = 20%"; blank
+// lines and lines starting with "#" are ignored, and a value may be wrapped
+// in double quotes. A missing file is only an error if mustExist is set.
+func loadConfig(set *flag.FlagSet, path string, mustExist bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if !mustExist && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: want key=value: %s", path, n, line)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+			val = val[1 : len(val)-1]
+		}
+
+		if key == "config" || key == "spec" || set.Lookup(key) == nil {
+			return fmt.Errorf("%s:%d: unknown option: %s", path, n, key)
+		}
+		if err := set.Set(key, val); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", path, n, key, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadSpec sets flags in set from the JSON object in the file at path, as in
+// {"base": "10s", "jitter": "20%", "min": "8s"}. Keys are option names as in
+// a config file, and values are strings, numbers, or booleans. The "base"
+// key isn't an option but the positional duration; it is returned for the
+// caller to use when the command line gives none.
+func loadSpec(set *flag.FlagSet, path string) (base string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var spec map[string]any
+	if err := dec.Decode(&spec); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, v := range spec {
+		var val string
+		switch v := v.(type) {
+		case string:
+			val = v
+		case json.Number:
+			val = v.String()
+		case bool:
+			val = strconv.FormatBool(v)
+		default:
+			return "", fmt.Errorf("%s: %s: want a string, number, or boolean", path, key)
+		}
+
+		if key == "base" {
+			base = val
+			continue
+		}
+		if key == "config" || key == "spec" || set.Lookup(key) == nil {
+			return "", fmt.Errorf("%s: unknown option: %s", path, key)
+		}
+		if err := set.Set(key, val); err != nil {
+			return "", fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+	return base, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeConfig writes contents to a temp config file and returns its path.
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseArgsConfig(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	path := writeConfig(t, "# shared defaults\njitter=20%\n\ndist = \"triangular\"\nverbose=true\n")
+	tests := []struct {
+		name    string
+		args    []string
+		wantLow time.Duration
+		wantHi  time.Duration
+	}{
+		{"file applies", []string{"--config", path, "10s"}, 8 * time.Second, 12 * time.Second},
+		{"command line wins", []string{"--config", path, "-j", "30%", "10s"}, 7 * time.Second, 13 * time.Second},
+		{"command line before config flag", []string{"-j", "30%", "--config=" + path, "10s"}, 7 * time.Second, 13 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs(%v) unexpected error: %v", tt.args, err)
+			}
+			if opts.low != tt.wantLow || opts.high != tt.wantHi {
+				t.Errorf("parseArgs(%v) = [%v, %v], want [%v, %v]", tt.args, opts.low, opts.high, tt.wantLow, tt.wantHi)
+			}
+			if opts.dist != "triangular" || opts.verbose != 1 {
+				t.Errorf("parseArgs(%v) dist = %q, verbose = %v; want the config file's", tt.args, opts.dist, opts.verbose)
+			}
+		})
+	}
+}
+
+func TestParseArgsUserConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	opts, err := parseArgs([]string{"10s"})
+	if err != nil {
+		t.Fatalf("parseArgs without a user config: %v", err)
+	}
+	if opts.low != 5*time.Second || opts.high != 15*time.Second {
+		t.Errorf("parseArgs = [%v, %v], want the default [5s, 15s]", opts.low, opts.high)
+	}
+
+	dir := filepath.Join(home, ".config", "jsleep")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config"), []byte("j=10%\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if opts, err = parseArgs([]string{"10s"}); err != nil {
+		t.Fatalf("parseArgs with a user config: %v", err)
+	}
+	if opts.low != 9*time.Second || opts.high != 11*time.Second {
+		t.Errorf("parseArgs = [%v, %v], want [9s, 11s] from the user config", opts.low, opts.high)
+	}
+}
+
+func TestParseArgsConfigErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"unknown key", "jiter=20%\n"},
+		{"nested config", "config=/etc/jsleep\n"},
+		{"missing value", "jitter\n"},
+		{"bad value", "verbose=maybe\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"--config", writeConfig(t, tt.contents), "10s"}
+			if _, err := parseArgs(args); err == nil {
+				t.Errorf("parseArgs with config %q succeeded, want error", tt.contents)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		args := []string{"--config", filepath.Join(t.TempDir(), "nope"), "10s"}
+		if _, err := parseArgs(args); err == nil {
+			t.Error("parseArgs with a missing --config file succeeded, want error")
+		}
+	})
+}
+
+func TestParseArgsSpec(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	path := writeConfig(t, `{"base": "10s", "jitter": "20%", "min": "9s", "dist": "triangular", "verbose": 2}`)
+	tests := []struct {
+		name    string
+		args    []string
+		wantLow time.Duration
+		wantHi  time.Duration
+	}{
+		{"spec applies", []string{"--spec", path}, 9 * time.Second, 12 * time.Second},
+		{"positional base wins", []string{"--spec", path, "20s"}, 16 * time.Second, 24 * time.Second},
+		{"command line wins", []string{"--spec", path, "-j", "50%"}, 9 * time.Second, 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs(%v) unexpected error: %v", tt.args, err)
+			}
+			if opts.low != tt.wantLow || opts.high != tt.wantHi {
+				t.Errorf("parseArgs(%v) = [%v, %v], want [%v, %v]", tt.args, opts.low, opts.high, tt.wantLow, tt.wantHi)
+			}
+			if opts.dist != "triangular" || opts.verbose != 2 {
+				t.Errorf("parseArgs(%v) dist = %q, verbose = %v; want the spec's", tt.args, opts.dist, opts.verbose)
+			}
+		})
+	}
+
+	t.Run("over config file", func(t *testing.T) {
+		config := writeConfig(t, "jitter=50%\nrng=pcg\n")
+		opts, err := parseArgs([]string{"--config", config, "--spec", path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.low != 9*time.Second || opts.high != 12*time.Second || opts.rngName != "pcg" {
+			t.Errorf("parseArgs = [%v, %v] rng %q, want [9s, 12s] rng pcg", opts.low, opts.high, opts.rngName)
+		}
+	})
+
+	for _, contents := range []string{
+		`{"base": "10 parsecs"}`,
+		`{"base": "10s", "min": "soon"}`,
+		`{"base": "10s", "bogus": "1"}`,
+		`{"base": "10s", "config": "other"}`,
+		`{"base": "10s", "jitter": ["20%"]}`,
+		`["10s"]`,
+		`{"base": "10s"`,
+	} {
+		if _, err := parseArgs([]string{"--spec", writeConfig(t, contents)}); err == nil {
+			t.Errorf("parseArgs with spec %s: want an error", contents)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is the minute and hour fields of a cron expression, as the
+// set of values each matches.
+type cronSchedule struct {
+	minutes [60]bool
+	hours   [24]bool
+}
+
+// parseCron parses a minute field, optionally followed by an hour field, in
+// cron syntax: each is "*" or a comma-separated list of values and a-b
+// ranges, any of which may end in /step. A missing hour field matches every
+// hour, so "0,15,30,45" is every quarter hour.
+func parseCron(expr string) (s cronSchedule, err error) {
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 1:
+		fields = append(fields, "*")
+	case 2:
+	default:
+		return s, fmt.Errorf("invalid cron expression: %q (want a minute field and an optional hour field)", expr)
+	}
+	if err = parseCronField(s.minutes[:], fields[0]); err != nil {
+		return s, fmt.Errorf("invalid cron minute field: %w", err)
+	}
+	if err = parseCronField(s.hours[:], fields[1]); err != nil {
+		return s, fmt.Errorf("invalid cron hour field: %w", err)
+	}
+	return s, nil
+}
+
+// parseCronField marks the values field matches in match, whose length is
+// the number of values the field can take starting from 0.
+func parseCronField(match []bool, field string) error {
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("%s: invalid step: %s", field, stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := 0, len(match)-1
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = cronValue(loStr, len(match)); err != nil {
+				return fmt.Errorf("%s: %w", field, err)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = cronValue(hiStr, len(match)); err != nil {
+					return fmt.Errorf("%s: %w", field, err)
+				}
+			} else if hasStep {
+				// As in cron, "a/n" runs from a to the end of the field.
+				hi = len(match) - 1
+			}
+			if hi < lo {
+				return fmt.Errorf("%s: range %s runs backwards", field, rng)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			match[v] = true
+		}
+	}
+	return nil
+}
+
+// cronValue parses s as a field value below limit.
+func cronValue(s string, limit int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v >= limit {
+		return 0, fmt.Errorf("invalid value: %s (want 0-%d)", s, limit-1)
+	}
+	return v, nil
+}
+
+// next returns the first whole minute after t, in t's location, that s
+// matches. parseCron never leaves a field empty, so there is one within a
+// day, or two when a daylight saving change skips the only hour that matches.
+func (s cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute)
+	for {
+		t = t.Add(time.Minute)
+		if s.minutes[t.Minute()] && s.hours[t.Hour()] {
+			return t
+		}
+	}
+}
+
+// runCron implements "jsleep cron": it sleeps until the next time the cron
+// expression matches, as --until would, taking the usual options after the
+// expression. Unlike a plain --until, the default is no jitter; pass one
+// explicitly, as in --plus 30s, to spread the wakeups out.
+func runCron(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return usageError{errors.New("usage: jsleep cron <expr> [options] [-- <command> [args...]]")}
+	}
+	s, err := parseCron(args[0])
+	if err != nil {
+		return usageError{fmt.Errorf("cron: %w", err)}
+	}
+
+	next := s.next(now())
+	args = append([]string{"--until", next.Format(time.RFC3339)}, args[1:]...)
+	opts, err := parseArgs(args)
+	if err != nil {
+		return usageError{err}
+	}
+	if opts.jitterFrom == "default" {
+		args = append([]string{"--fixed"}, args...)
+	}
+	return run(args, stdout, stderr)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	ref := time.Date(2024, time.March, 10, 8, 50, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"*", 30 * time.Second},
+		{"0,15,30,45", 9*time.Minute + 30*time.Second},
+		{"*/15", 9*time.Minute + 30*time.Second},
+		{"50", 59*time.Minute + 30*time.Second},
+		{"51 8", 30 * time.Second},
+		{"0 9-17", 9*time.Minute + 30*time.Second},
+		{"30 8", 23*time.Hour + 39*time.Minute + 30*time.Second},
+		{"10-20/5 */2", 1*time.Hour + 19*time.Minute + 30*time.Second},
+		{"5/20 0", 15*time.Hour + 14*time.Minute + 30*time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", tt.expr, err)
+			}
+			if got := s.next(ref).Sub(ref); got != tt.want {
+				t.Errorf("parseCron(%q).next(%v) is %v away, want %v", tt.expr, ref, got, tt.want)
+			}
+		})
+	}
+
+	for _, expr := range []string{"", "60", "0 24", "a", "*/0", "20-10", "1,", "0 0 * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): want an error", expr)
+		}
+	}
+}
+
+func TestRunCron(t *testing.T) {
+	ref := time.Date(2024, time.March, 10, 8, 50, 0, 0, time.Local)
+	now = func() time.Time { return ref }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no jitter by default", []string{"cron", "0", "--dry-run"}, "sleeping for 10m0s\n"},
+		{"explicit jitter", []string{"cron", "0", "-n", "--plus", "30s", "--at", "100%"}, "sleeping for 10m30s\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(tt.args, &stdout, &stderr); err != nil {
+				t.Fatalf("run(%v): %v", tt.args, err)
+			}
+			if stderr.String() != tt.want {
+				t.Errorf("run(%v) stderr = %q, want %q", tt.args, stderr.String(), tt.want)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"cron"}, {"cron", "61"}, {"cron", "0", "10s"}} {
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); exitCode(err) != exitUsage {
+			t.Errorf("run(%v) = %v, want a usage error", args, err)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// drain reads and discards r in the background until the returned func is
+// called, so a producer writing into jsleep's stdin isn't left blocked on a
+// full pipe while it sleeps. A read already waiting when draining stops is
+// left to finish, and whatever it reads is discarded too.
+func drain(r io.Reader) (stop func()) {
+	var stopped atomic.Bool
+	go func() {
+		buf := make([]byte, 32*1024)
+		for !stopped.Load() {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return func() { stopped.Store(true) }
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRunDrain(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	orig := stdin
+	stdin = r
+	t.Cleanup(func() { stdin = orig })
+
+	// Far more than a pipe buffers, so the writer blocks unless jsleep reads.
+	const size = 1 << 20
+	written := make(chan error, 1)
+	go func() {
+		_, err := w.Write(make([]byte, size))
+		w.Close()
+		written <- err
+	}()
+
+	if err := run([]string{"--drain", "-j", "0%", "200ms"}, new(bytes.Buffer), new(bytes.Buffer)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("writing to jsleep's stdin: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("writer still blocked after the sleep finished")
+	}
+
+	if _, err := parseArgs([]string{"--drain", "--interactive", "10s"}); err == nil {
+		t.Error("parseArgs accepted --drain with --interactive")
+	}
+}
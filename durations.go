@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thomasdesr/jsleep/jitter"
+)
+
+// percentOfBase returns the percent s of base.
+func percentOfBase(base time.Duration, s string) (*time.Duration, error) {
+	frac, err := jitter.ParsePercent(s)
+	if err != nil {
+		return nil, err
+	}
+	d := math.Round(float64(base) * frac)
+	if d >= math.MaxInt64 {
+		return nil, fmt.Errorf("%s of %s is out of range", s, base)
+	}
+	r := time.Duration(d)
+	return &r, nil
+}
+
+// sumDurations parses each token as a duration, reading "-" from stdin, and
+// returns their total.
+func sumDurations(tokens []string, p jitter.DurationParser) (time.Duration, error) {
+	var sum time.Duration
+	for _, tok := range tokens {
+		if strings.HasSuffix(tok, "%") {
+			return 0, fmt.Errorf("jitter percent must come after the durations: %s", tok)
+		}
+
+		var d time.Duration
+		var err error
+		if tok == "-" {
+			d, err = readDuration(stdin, p)
+		} else {
+			d, err = p.Parse(tok)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if (d > 0 && sum > math.MaxInt64-d) || (d < 0 && sum < math.MinInt64-d) {
+			return 0, errors.New("sum of durations overflows time.Duration")
+		}
+		sum += d
+	}
+	return sum, nil
+}
+
+// readBaseFile parses the contents of the --base-file at path as a
+// non-negative duration.
+func readBaseFile(path string, p jitter.DurationParser) (time.Duration, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("--base-file: %w", err)
+	}
+	d, err := p.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("--base-file %s: %w", path, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("--base-file %s: base duration must be non-negative: %s", path, d)
+	}
+	return d, nil
+}
+
+// rereadBase resolves opts.baseArgs again for the current contents of
+// opts.baseFile and takes the new base and interval from that, leaving opts
+// alone if it fails. The random source carries on as it was.
+func rereadBase(opts *options) error {
+	fresh, err := parseArgs(opts.baseArgs)
+	if err != nil {
+		return err
+	}
+	fresh.sampling.Source = opts.sampling.Source
+	opts.base, opts.low, opts.high = fresh.base, fresh.low, fresh.high
+	opts.unclampedLow, opts.unclampedHigh = fresh.unclampedLow, fresh.unclampedHigh
+	opts.sampling = fresh.sampling
+	return nil
+}
+
+// readDuration parses the first whitespace-separated token read from r.
+func readDuration(r io.Reader, p jitter.DurationParser) (time.Duration, error) {
+	sc := bufio.NewScanner(r)
+	sc.Split(bufio.ScanWords)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return 0, fmt.Errorf("reading duration from stdin: %w", err)
+		}
+		return 0, errors.New("no duration on stdin")
+	}
+	d, err := p.Parse(sc.Text())
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration on stdin: %w", err)
+	}
+	return d, nil
+}
+
+// parseChoices parses the comma-separated durations of --choices.
+func parseChoices(s string, p jitter.DurationParser) ([]time.Duration, error) {
+	var ds []time.Duration
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		d, err := p.Parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("--choices: %w", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("--choices: duration must be non-negative: %s", field)
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// readDurationFile reads one duration per line from the file at path,
+// skipping blank lines and lines starting with "#".
+func readDurationFile(path string, p jitter.DurationParser) ([]time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ds []time.Duration
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d, err := p.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s:%d: duration must be non-negative: %s", path, n, line)
+		}
+		ds = append(ds, d)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(ds) == 0 {
+		return nil, fmt.Errorf("no durations in %s", path)
+	}
+	return ds, nil
+}
+
+// parseUntil returns how long from ref until the wall-clock time s, given as
+// HH:MM, HH:MM:SS, RFC3339, or +<duration>. Clock times without a date refer
+// to their next occurrence after ref; RFC3339 times already in the past yield
+// zero.
+func parseUntil(s string, ref time.Time, durations jitter.DurationParser) (time.Duration, error) {
+	t, clock, err := parseWallTime(s, ref, durations)
+	if err != nil {
+		return 0, err
+	}
+	if clock && !t.After(ref) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return max(t.Sub(ref), 0), nil
+}
+
+// parseWallTime parses s as HH:MM, HH:MM:SS, RFC3339, or +<duration>, read
+// by durations, for that long after ref. A clock time is taken to be on
+// ref's day, in ref's location, and reported with clock set.
+func parseWallTime(s string, ref time.Time, durations jitter.DurationParser) (t time.Time, clock bool, err error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	if rel, ok := strings.CutPrefix(s, "+"); ok {
+		d, err := durations.Parse(rel)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid time: %s: %w", s, err)
+		}
+		return ref.Add(d), false, nil
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		c, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		return time.Date(ref.Year(), ref.Month(), ref.Day(), c.Hour(), c.Minute(), c.Second(), 0, ref.Location()), true, nil
+	}
+
+	return time.Time{}, false, fmt.Errorf("invalid time: %s (want HH:MM, HH:MM:SS, RFC3339, or +duration)", s)
+}
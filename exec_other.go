@@ -0,0 +1,33 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// execCommand runs path as a child process and exits with its status, since
+// there is no exec(2) to replace the current process on this platform. It
+// only returns if the command could not be started.
+func execCommand(path string, argv []string) error {
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// shellCommand returns a command that runs s with cmd.exe.
+func shellCommand(s string) *exec.Cmd {
+	return exec.Command("cmd", "/C", s)
+}
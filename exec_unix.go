@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// execCommand replaces the current process with path, so the command
+// inherits the terminal and its exit status becomes ours. It only returns on
+// failure.
+func execCommand(path string, argv []string) error {
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// shellCommand returns a command that runs s with sh.
+func shellCommand(s string) *exec.Cmd {
+	return exec.Command("sh", "-c", s)
+}
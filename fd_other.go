@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// openOutputFD fails: file descriptors other than the standard streams
+// aren't inherited by number here.
+func openOutputFD(fd int) (*os.File, error) {
+	return nil, errors.New("file descriptors are not supported on this platform")
+}
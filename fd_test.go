@@ -0,0 +1,60 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRunOutputFD(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// run closes the descriptor it's given, so give it a copy.
+	fd, err := syscall.Dup(int(w.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	if err := run([]string{"--output-fd", strconv.Itoa(fd), "-v", "-j", "0%", "1ms"}, new(bytes.Buffer), &stderr); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "sleeping for 1ms") {
+		t.Errorf("fd %d got %q, want the verbose line", fd, got)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+
+	closed, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(closed)
+	for _, fd := range []uintptr{r.Fd(), uintptr(closed)} {
+		args := []string{"--output-fd", strconv.Itoa(int(fd)), "-n", "1ms"}
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); err == nil || !strings.Contains(err.Error(), "--output-fd") {
+			t.Errorf("run(%v) = %v, want an --output-fd error", args, err)
+		}
+	}
+
+	for _, args := range [][]string{{"--output-fd", "0", "1ms"}, {"--output-fd", "three", "1ms"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openOutputFD returns the already-open file descriptor fd for --output-fd,
+// failing unless it is open for writing.
+func openOutputFD(fd int) (*os.File, error) {
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("file descriptor %d is not open: %w", fd, errno)
+	}
+	if flags&syscall.O_ACCMODE == syscall.O_RDONLY {
+		return nil, fmt.Errorf("file descriptor %d is not open for writing", fd)
+	}
+	// Share the standard streams' Files, which are never closed.
+	switch fd {
+	case 1:
+		return os.Stdout, nil
+	case 2:
+		return os.Stderr, nil
+	}
+	return os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd)), nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/thomasdesr/jsleep/jitter"
+)
+
+// flagValues holds the raw values of flags that parseArgs resolves further
+// before they end up in options.
+type flagValues struct {
+	configStr, jitterStr, rangeStr, offsetStr, clampModeStr string
+	minStr, maxStr, untilStr, percentOfStr, distFileStr     string
+	distStr, seedStr, rngStr, roundStr, floorStr, ceilStr   string
+	countStr, warnAboveStr, jobsStr, probabilityStr         string
+	deadlineStr, exitBucketStr, warmupStr, formatStr        string
+	pidWaitStr, pidModeStr                                  string
+	alignStr                                                string
+	rngRetriesStr                                           string
+	atStr                                                   string
+	jitterModeStr                                           string
+	outputFDStr                                             string
+	floorPercentStr, ceilPercentStr                         string
+	choicesStr                                              string
+	minSleepStr                                             string
+	seedEnvStr                                              string
+	capWidthStr                                             string
+	plusStr, minusStr                                       string
+	jitterCapStr                                            string
+	untilFileStr, timeoutStr                                string
+	waitTCPStr                                              string
+	specStr                                                 string
+	entropyFileStr                                          string
+	quantizeStr                                             string
+	baseFileStr, onErrorStr                                 string
+	ciEnvStr                                                string
+	maxTotalStr, backoffFactorStr, statsStr, histStr        string
+	allowZeroFloor, noClampZero, clampNegative, fixed       bool
+	strictUnits                                             bool
+	decimalComma                                            bool
+	skipIfCI                                                bool
+}
+
+// flagDef describes one command-line flag. Every flag jsleep accepts comes
+// from flagDefs, so parseArgs and the completion scripts can't disagree.
+type flagDef struct {
+	long, short string // short is "" if the flag has no one-letter alias
+	value       any    // *string, *bool, or *countValue
+	def         string // default for string flags
+	usage       string
+}
+
+// takesValue reports whether the flag needs an argument.
+func (f flagDef) takesValue() bool {
+	_, ok := f.value.(*string)
+	return ok
+}
+
+// define registers f on fs under its long and short names.
+func (f flagDef) define(fs *flag.FlagSet) {
+	for _, name := range []string{f.long, f.short} {
+		if name == "" {
+			continue
+		}
+		switch p := f.value.(type) {
+		case *string:
+			fs.StringVar(p, name, f.def, f.usage)
+		case *bool:
+			fs.BoolVar(p, name, false, f.usage)
+		case *countValue:
+			fs.Var(p, name, f.usage)
+		}
+	}
+}
+
+// givenFlags returns the long names of the flags in defs that fs has been
+// given by either name, whether on the command line, in a config file, or
+// in a --spec, even where the value given is the default.
+func givenFlags(fs *flag.FlagSet, defs []flagDef) map[string]bool {
+	long := make(map[string]string, 2*len(defs))
+	for _, f := range defs {
+		long[f.long] = f.long
+		if f.short != "" {
+			long[f.short] = f.long
+		}
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[long[f.Name]] = true })
+	return given
+}
+
+// countValue is a flag that, like a bool flag, takes no argument, and counts
+// how many times it is given. An explicit number sets the count, true adds
+// one like the bare flag, and false resets it to zero.
+type countValue int
+
+func (c *countValue) String() string { return strconv.Itoa(int(*c)) }
+
+func (c *countValue) Set(s string) error {
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		*c = countValue(n)
+		return nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return errors.New("want a count or a boolean")
+	}
+	if b {
+		*c++
+	} else {
+		*c = 0
+	}
+	return nil
+}
+
+func (c *countValue) IsBoolFlag() bool { return true }
+
+// flagDefs returns every flag, bound to fields of opts and fv.
+func flagDefs(opts *options, fv *flagValues) []flagDef {
+	return []flagDef{
+		{"config", "", &fv.configStr, "", "file of default option values"},
+		{"base-file", "", &fv.baseFileStr, "", "file holding the base duration, re-read before every sleep"},
+		{"on-error", "", &fv.onErrorStr, "fail", "when --base-file can't be re-read: fail or skip"},
+		{"spec", "", &fv.specStr, "", "JSON file of option values and a base duration"},
+		{"jitter", "j", &fv.jitterStr, "", "percent or ratio jitter (e.g., 20% or 0.2)"},
+		{"range", "r", &fv.rangeStr, "", "absolute jitter range (e.g., 2s for ±2 seconds, or 10% of the base)"},
+		{"plus", "", &fv.plusStr, "", "absolute jitter above the base"},
+		{"minus", "", &fv.minusStr, "", "absolute jitter below the base"},
+		{"jitter-mode", "", &fv.jitterModeStr, jitter.Additive, "how jitter applies: additive or multiplicative"},
+		{"jitter-cap", "", &fv.jitterCapStr, "", "limit percent jitter to this much either way"},
+		{"allow-zero-floor", "", &fv.allowZeroFloor, "", "allow jitter below zero without warning"},
+		{"no-clamp-zero", "", &fv.noClampZero, "", "fail instead of flooring an interval below zero at 0"},
+		{"fixed", "", &fv.fixed, "", "sleep exactly the base duration, ignoring all jitter"},
+		{"strict-units", "", &fv.strictUnits, "", "reject durations without a unit"},
+		{"decimal-comma", "", &fv.decimalComma, "", "read commas in durations as decimal points"},
+		{"clamp-negative", "", &fv.clampNegative, "", "treat a negative base duration as zero"},
+		{"offset", "", &fv.offsetStr, "", "shift the jittered interval by this duration"},
+		{"cap-width", "", &fv.capWidthStr, "", "narrow the interval around its midpoint to at most this wide"},
+		{"clamp-mode", "", &fv.clampModeStr, jitter.Clip, "how --min/--max apply: clip or shift"},
+		{"min", "m", &fv.minStr, "", "minimum duration bound"},
+		{"max", "M", &fv.maxStr, "", "maximum duration bound"},
+		{"floor-percent", "", &fv.floorPercentStr, "", "minimum as a percent of the base"},
+		{"ceil-percent", "", &fv.ceilPercentStr, "", "maximum as a percent of the base"},
+		{"until", "u", &fv.untilStr, "", "wall-clock time to sleep until"},
+		{"until-file", "", &fv.untilFileStr, "", "keep sleeping until this file exists"},
+		{"wait-for-tcp", "", &fv.waitTCPStr, "", "keep sleeping until host:port accepts a TCP connection"},
+		{"timeout", "", &fv.timeoutStr, "", "with --until-file, give up after this long"},
+		{"deadline", "", &fv.deadlineStr, "", "wall-clock time no sleep may run past"},
+		{"pid-wait", "", &fv.pidWaitStr, "", "process to wait for along with the sleep"},
+		{"pid-mode", "", &fv.pidModeStr, pidLater, "with --pid-wait, return at the later or earlier end"},
+		{"percent-of", "", &fv.percentOfStr, "", "reference duration the positional percent is taken of"},
+		{"dist-file", "", &fv.distFileStr, "", "file of durations to pick each base from"},
+		{"choices", "", &fv.choicesStr, "", "comma-separated durations to pick each base from"},
+		{"dist", "d", &fv.distStr, jitter.Uniform, "sampling distribution"},
+		{"at", "", &fv.atStr, "", "take every sleep at this percentile instead of at random"},
+		{"seed", "s", &fv.seedStr, "", "seed for a deterministic PRNG"},
+		{"seed-env", "", &fv.seedEnvStr, "", "derive --seed from this environment variable's value"},
+		{"warmup", "", &fv.warmupStr, "", "discard this many draws before the first real one"},
+		{"rng", "", &fv.rngStr, "", "random source: crypto, pcg, or math"},
+		{"rng-retries", "", &fv.rngRetriesStr, "1000", "most draws crypto makes for each value"},
+		{"entropy-file", "", &fv.entropyFileStr, "", "file crypto reads random bytes from instead of crypto/rand"},
+		{"verbose", "v", (*countValue)(&opts.verbose), "", "verbose output; repeat for more detail"},
+		{"format", "", &fv.formatStr, "", "text/template for the verbose line"},
+		{"output-fd", "", &fv.outputFDStr, "", "file descriptor for verbose and countdown output instead of stderr"},
+		{"color", "", &opts.color, "auto", "colorize verbose output: auto, always, or never"},
+		{"quiet", "q", &opts.quiet, "", "suppress all non-error output"},
+		{"clamp-report", "", &opts.clampReport, "", "report when clamping changes the interval"},
+		{"countdown", "", &opts.countdown, "", "show time remaining"},
+		{"interactive", "", &opts.interactive, "", "countdown with keys to pause, resume, and skip"},
+		{"drain", "", &opts.drain, "", "read and discard stdin while sleeping"},
+		{"spin", "", &opts.spin, "", "busy-wait for sleeps under 2ms"},
+		{"cpu-affinity-safe", "", &opts.monotonic, "", "measure sleeps only on the monotonic clock"},
+		{"json", "", &opts.json, "", "JSON output"},
+		{"duration-format", "", &opts.durationFormat, "", "how to print durations: go, ns, or human"},
+		{"report-json-on-signal", "", &opts.reportOnSignal, "", "print how long was slept as JSON if interrupted"},
+		{"round", "", &fv.roundStr, "", "round the chosen duration to a multiple of this unit"},
+		{"floor", "", &fv.floorStr, "", "round the chosen duration down to a multiple of this unit"},
+		{"ceil", "", &fv.ceilStr, "", "round the chosen duration up to a multiple of this unit"},
+		{"quantize", "", &fv.quantizeStr, "", "snap the chosen duration to a multiple of this step within the interval"},
+		{"align", "", &fv.alignStr, "", "extend each sleep to wake on a multiple of this unit"},
+		{"min-sleep", "", &fv.minSleepStr, "", "never sleep less than this, whatever was chosen"},
+		{"pre-exec", "", &opts.preExec, "", "shell command to run before each sleep"},
+		{"post-exec", "", &opts.postExec, "", "shell command to run after each sleep"},
+		{"metrics-file", "", &opts.metricsFile, "", "file to write Prometheus metrics to after sleeping"},
+		{"state-file", "", &opts.stateFile, "", "file recording the wake time, so a restarted run resumes the sleep"},
+		{"exit-bucket", "", &fv.exitBucketStr, "", "exit with which of n buckets of the interval the sleep fell in"},
+		{"log-file", "", &opts.logFile, "", "file to append chosen durations to"},
+		{"syslog", "", &opts.syslog, "", "send the verbose line to syslog"},
+		{"syslog-tag", "", &opts.syslogTag, "jsleep", "tag for --syslog messages"},
+		{"count", "c", &fv.countStr, "1", "number of sleeps; 0 or inf for forever"},
+		{"warn-above", "", &fv.warnAboveStr, "", "warn when a chosen sleep exceeds this duration"},
+		{"strict", "", &opts.strict, "", "fail instead of warning for --warn-above"},
+		{"jobs", "", &fv.jobsStr, "1", "number of sleeps to run concurrently"},
+		{"probability", "", &fv.probabilityStr, "", "percent chance of actually sleeping"},
+		{"max-total", "", &fv.maxTotalStr, "", "budget for total time slept"},
+		{"backoff", "", &opts.backoff, "", "grow the base each iteration"},
+		{"backoff-factor", "", &fv.backoffFactorStr, "2", "backoff multiplier"},
+		{"stats", "", &fv.statsStr, "", "summarize n samples instead of sleeping"},
+		{"hist", "", &fv.histStr, "", "draw a histogram of n samples instead of sleeping"},
+		{"dry-run", "n", &opts.dryRun, "", "choose a duration without sleeping"},
+		{"explain", "", &opts.explain, "", "print the resolved command instead of sleeping and running it"},
+		{"skip-if-ci", "", &fv.skipIfCI, "", "don't sleep when running in CI"},
+		{"ci-env", "", &fv.ciEnvStr, "CI,GITHUB_ACTIONS", "comma-separated variables that mean --skip-if-ci is in CI"},
+		{"dump-args", "", &opts.dumpArgs, "", "print the resolved options and exit"},
+		{"ignore-signals", "", &opts.ignoreSignals, "", "don't handle SIGINT"},
+	}
+}
+
+// parseFlags parses args with fs and returns the positional arguments. Flags
+// may come before, between, or after them, as in "10s --jitter 20%".
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var pos []string
+	for len(args) > 0 {
+		flags, negatives := splitAtNegative(fs, args)
+		if err := fs.Parse(flags); err != nil {
+			return nil, err
+		}
+		rest := slices.Concat(fs.Args(), negatives)
+		if len(rest) == 0 {
+			break
+		}
+		pos, args = append(pos, rest[0]), rest[1:]
+	}
+	return pos, nil
+}
+
+// expandCounts rewrites a run of a repeatable short flag, as in "-vvv", into
+// one argument per repetition, which the flag package can parse.
+func expandCounts(fs *flag.FlagSet, args []string) []string {
+	var out []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' {
+			if f := fs.Lookup(arg[1:2]); f != nil && strings.Count(arg[1:], arg[1:2]) == len(arg)-1 {
+				if _, ok := f.Value.(*countValue); ok {
+					for range len(arg) - 1 {
+						out = append(out, arg[:2])
+					}
+					continue
+				}
+			}
+		}
+		out = append(out, arg)
+		// Leave the value of a flag that takes one alone, as in "--format -vv".
+		if name := strings.TrimLeft(arg, "-"); arg != name && !strings.Contains(name, "=") {
+			if f := fs.Lookup(name); f != nil && !isBoolFlag(f) && i+1 < len(args) {
+				i++
+				out = append(out, args[i])
+			}
+		}
+	}
+	return out
+}
+
+// isBoolFlag reports whether f takes no argument.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// splitAtNegative splits args before the first positional argument if that
+// is a negative number such as "-5s", which the flag package would otherwise
+// reject as an unknown flag. Values of flags that take one, as in
+// "--offset -2s", are left alone.
+func splitAtNegative(fs *flag.FlagSet, args []string) (flags, rest []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		if ('0' <= arg[1] && arg[1] <= '9') || arg[1] == '.' {
+			return args[:i], args[i:]
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return args, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestFlagDefs(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, f := range flagDefs(new(options), new(flagValues)) {
+		for _, name := range []string{f.long, f.short} {
+			if name != "" && seen[name] {
+				t.Errorf("flag name %q is defined twice", name)
+			}
+			seen[name] = true
+		}
+		if len(f.short) > 1 {
+			t.Errorf("--%s has a multi-letter short name %q", f.long, f.short)
+		}
+		if !f.takesValue() && f.def != "" {
+			t.Errorf("boolean --%s has a default %q", f.long, f.def)
+		}
+	}
+}
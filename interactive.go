@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// keyAction is what a keypress asks an --interactive sleep to do.
+type keyAction int
+
+const (
+	keyNone keyAction = iota
+	keyPause
+	keyResume
+	keySkip
+)
+
+// actionFor maps a key read from the terminal to its keyAction.
+func actionFor(b byte) keyAction {
+	switch b {
+	case 'p', 'P':
+		return keyPause
+	case 'r', 'R':
+		return keyResume
+	case 's', 'S':
+		return keySkip
+	}
+	return keyNone
+}
+
+// pausable tracks the deadline of a sleep that can be paused: while paused
+// the time left stays put, and resuming pushes the deadline back by however
+// long the pause lasted.
+type pausable struct {
+	deadline time.Time
+	pausedAt time.Time // zero while running
+}
+
+func (p *pausable) paused() bool { return !p.pausedAt.IsZero() }
+
+func (p *pausable) pause(t time.Time) {
+	if !p.paused() {
+		p.pausedAt = t
+	}
+}
+
+func (p *pausable) resume(t time.Time) {
+	if p.paused() {
+		p.deadline = p.deadline.Add(t.Sub(p.pausedAt))
+		p.pausedAt = time.Time{}
+	}
+}
+
+// remaining returns how long is left at t.
+func (p *pausable) remaining(t time.Time) time.Duration {
+	if p.paused() {
+		t = p.pausedAt
+	}
+	return remaining(p.deadline, t)
+}
+
+// readKeys sends every byte read from r on the returned channel, which is
+// closed once r fails. It reads for the rest of the process, so it is
+// started once and shared by every sleep.
+func readKeys(r io.Reader) <-chan byte {
+	keys := make(chan byte)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 1)
+		for {
+			if _, err := r.Read(buf); err != nil {
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+	return keys
+}
+
+// interactiveSleep is sleep for --interactive: it redraws the time left on w
+// every 100ms and acts on keys as they arrive, returning true once the sleep
+// is over or skipped and false if interrupt fires first.
+func interactiveSleep(d time.Duration, interrupt <-chan os.Signal, keys <-chan byte, w io.Writer) bool {
+	p := pausable{deadline: time.Now().Add(d)}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	defer fmt.Fprint(w, "\r\033[K")
+
+	render := func() {
+		left := p.remaining(time.Now()).Round(100 * time.Millisecond)
+		if p.paused() {
+			fmt.Fprintf(w, "\rpaused, %s remaining (r resume, s skip)\033[K", left)
+		} else {
+			fmt.Fprintf(w, "\rsleeping %s remaining (p pause, s skip)\033[K", left)
+		}
+	}
+	render()
+
+	for {
+		select {
+		case <-timer.C:
+			if p.paused() {
+				continue
+			}
+			if left := p.remaining(time.Now()); left > 0 {
+				timer.Reset(left)
+				continue
+			}
+			return true
+		case <-interrupt:
+			return false
+		case b, ok := <-keys:
+			if !ok {
+				// The terminal went away; finish the sleep without it.
+				keys = nil
+				p.resume(time.Now())
+				timer.Reset(p.remaining(time.Now()))
+				continue
+			}
+			switch actionFor(b) {
+			case keyPause:
+				p.pause(time.Now())
+				timer.Stop()
+			case keyResume:
+				if p.paused() {
+					p.resume(time.Now())
+					timer.Reset(p.remaining(time.Now()))
+				}
+			case keySkip:
+				return true
+			}
+			render()
+		case <-ticker.C:
+			render()
+		}
+	}
+}
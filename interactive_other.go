@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// rawTerminal fails: there is no stty to switch the console with here.
+func rawTerminal(f *os.File) (restore func(), err error) {
+	return nil, errors.New("--interactive is not supported on this platform")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActionFor(t *testing.T) {
+	for _, tt := range []struct {
+		key  byte
+		want keyAction
+	}{
+		{'p', keyPause},
+		{'P', keyPause},
+		{'r', keyResume},
+		{'R', keyResume},
+		{'s', keySkip},
+		{'S', keySkip},
+		{'q', keyNone},
+		{' ', keyNone},
+		{'\n', keyNone},
+	} {
+		if got := actionFor(tt.key); got != tt.want {
+			t.Errorf("actionFor(%q) = %d, want %d", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestPausable(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := pausable{deadline: start.Add(10 * time.Second)}
+
+	if got := p.remaining(start.Add(3 * time.Second)); got != 7*time.Second {
+		t.Errorf("remaining after 3s = %s, want 7s", got)
+	}
+
+	// Paused at 3s, the time left holds at 7s however long the pause.
+	p.pause(start.Add(3 * time.Second))
+	p.pause(start.Add(4 * time.Second)) // already paused; no effect
+	if got := p.remaining(start.Add(time.Minute)); got != 7*time.Second {
+		t.Errorf("remaining while paused = %s, want 7s", got)
+	}
+
+	// Resumed at 1m, the sleep now ends 7s later.
+	p.resume(start.Add(time.Minute))
+	p.resume(start.Add(2 * time.Minute)) // already running; no effect
+	if want := start.Add(67 * time.Second); !p.deadline.Equal(want) {
+		t.Errorf("deadline after resuming = %s, want %s", p.deadline, want)
+	}
+	if got := p.remaining(start.Add(65 * time.Second)); got != 2*time.Second {
+		t.Errorf("remaining after resuming = %s, want 2s", got)
+	}
+	if got := p.remaining(start.Add(time.Hour)); got != 0 {
+		t.Errorf("remaining past the deadline = %s, want 0", got)
+	}
+}
+
+func TestInteractiveSleep(t *testing.T) {
+	t.Run("skip", func(t *testing.T) {
+		keys := make(chan byte, 1)
+		keys <- 's'
+		start := time.Now()
+		if !interactiveSleep(time.Hour, nil, keys, io.Discard) {
+			t.Fatal("skipped sleep reported an interruption")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("skipped sleep took %v", elapsed)
+		}
+	})
+
+	t.Run("pause and resume", func(t *testing.T) {
+		const d, pause = 50 * time.Millisecond, 100 * time.Millisecond
+		keys := make(chan byte)
+		go func() {
+			keys <- 'p'
+			time.Sleep(pause)
+			keys <- 'r'
+		}()
+		var buf bytes.Buffer
+		start := time.Now()
+		if !interactiveSleep(d, nil, keys, &buf) {
+			t.Fatal("sleep reported an interruption")
+		}
+		if elapsed := time.Since(start); elapsed < d+pause {
+			t.Errorf("sleep of %s paused for %s took only %v", d, pause, elapsed)
+		}
+		if !strings.Contains(buf.String(), "paused") {
+			t.Errorf("output %q never showed the pause", buf.String())
+		}
+	})
+
+	t.Run("interrupt", func(t *testing.T) {
+		interrupt := make(chan os.Signal, 1)
+		interrupt <- os.Interrupt
+		if interactiveSleep(time.Hour, interrupt, make(chan byte), io.Discard) {
+			t.Error("sleep completed despite a pending signal")
+		}
+	})
+
+	t.Run("keys closed", func(t *testing.T) {
+		keys := make(chan byte)
+		close(keys)
+		if !interactiveSleep(10*time.Millisecond, nil, keys, io.Discard) {
+			t.Error("sleep reported an interruption")
+		}
+	})
+}
+
+func TestRunSleepInteractive(t *testing.T) {
+	// --interactive without --countdown leaves run with no progress writer
+	// of its own.
+	opts, err := parseArgs([]string{"--interactive", "-j", "0%", "300ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(chan byte, 1)
+	keys <- 's'
+	opts.keys = keys
+	if _, ok := runSleep(opts.base, opts, nil, nil); !ok {
+		t.Error("skipped sleep reported an interruption")
+	}
+}
+
+func TestReadKeys(t *testing.T) {
+	var got []byte
+	for b := range readKeys(strings.NewReader("prs")) {
+		got = append(got, b)
+	}
+	if string(got) != "prs" {
+		t.Errorf("readKeys sent %q, want %q", got, "prs")
+	}
+}
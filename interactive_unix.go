@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// rawTerminal switches the terminal on f to deliver keys one at a time
+// without echoing them, and returns a func that restores its settings, which
+// only acts the first time it is called. It leaves signal keys alone, so
+// Ctrl-C still interrupts.
+func rawTerminal(f *os.File) (restore func(), err error) {
+	saved, err := stty(f, "-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty(f, "-icanon", "-echo", "min", "1"); err != nil {
+		return nil, err
+	}
+	return sync.OnceFunc(func() { stty(f, saved) }), nil
+}
+
+// stty runs stty(1) with args on the terminal f and returns its output.
+func stty(f *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = f
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
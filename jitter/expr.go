@@ -0,0 +1,274 @@
+package jitter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isExpression reports whether s uses arithmetic rather than being a single
+// duration. A leading "-" alone is just a negative duration, and the sign of
+// an exponent, as in 1e-3d, isn't an operator either.
+func isExpression(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '/', '(', ')':
+			return true
+		case '+':
+			if !isExponentSign(s, i) {
+				return true
+			}
+		case '-':
+			if i > 0 && !isExponentSign(s, i) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isExponentSign reports whether the "+" or "-" at s[i] is the sign of an
+// exponent: right after an "e" or "E" that follows a digit.
+func isExponentSign(s string, i int) bool {
+	return i >= 2 && (s[i-1] == 'e' || s[i-1] == 'E') && '0' <= s[i-2] && s[i-2] <= '9'
+}
+
+// exprValue is either a duration or a plain number.
+type exprValue struct {
+	d        time.Duration
+	n        float64
+	duration bool
+}
+
+// exprParser evaluates duration arithmetic such as "(1m+30s)/2" by
+// recursive descent:
+//
+//	expr   = term { ("+" | "-") term }
+//	term   = factor { ("*" | "/") factor }
+//	factor = ("-" | "+") factor | "(" expr ")" | operand
+//
+// An operand is a plain number or anything DurationParser.Parse accepts.
+// Plain numbers scale durations; added to a duration, or left as the final
+// result, they are in the default unit.
+type exprParser struct {
+	p    DurationParser
+	src  string
+	toks []string
+	pos  int
+}
+
+// parseExpression evaluates the arithmetic expression s.
+func (p DurationParser) parseExpression(s string) (time.Duration, error) {
+	e := &exprParser{p: p, src: s, toks: tokenizeExpr(s)}
+	v, err := e.expr()
+	if err != nil {
+		return 0, err
+	}
+	if e.pos != len(e.toks) {
+		return 0, fmt.Errorf("invalid expression: %s", s)
+	}
+	return e.toDuration(v)
+}
+
+// tokenizeExpr splits s into operators, parentheses, and the operands
+// between them, dropping spaces.
+func tokenizeExpr(s string) []string {
+	var toks []string
+	start := -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !strings.ContainsRune("+-*/() ", rune(c)) || (start >= 0 && isExponentSign(s, i)) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			toks, start = append(toks, s[start:i]), -1
+		}
+		if c != ' ' {
+			toks = append(toks, s[i:i+1])
+		}
+	}
+	if start >= 0 {
+		toks = append(toks, s[start:])
+	}
+	return toks
+}
+
+func (e *exprParser) peek() string {
+	if e.pos < len(e.toks) {
+		return e.toks[e.pos]
+	}
+	return ""
+}
+
+func (e *exprParser) expr() (exprValue, error) {
+	v, err := e.term()
+	if err != nil {
+		return exprValue{}, err
+	}
+	for op := e.peek(); op == "+" || op == "-"; op = e.peek() {
+		e.pos++
+		w, err := e.term()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if op == "-" {
+			if w, err = e.negate(w); err != nil {
+				return exprValue{}, err
+			}
+		}
+		if v, err = e.add(v, w); err != nil {
+			return exprValue{}, err
+		}
+	}
+	return v, nil
+}
+
+func (e *exprParser) term() (exprValue, error) {
+	v, err := e.factor()
+	if err != nil {
+		return exprValue{}, err
+	}
+	for op := e.peek(); op == "*" || op == "/"; op = e.peek() {
+		e.pos++
+		w, err := e.factor()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if op == "*" {
+			v, err = e.mul(v, w)
+		} else {
+			v, err = e.div(v, w)
+		}
+		if err != nil {
+			return exprValue{}, err
+		}
+	}
+	return v, nil
+}
+
+func (e *exprParser) factor() (exprValue, error) {
+	switch tok := e.peek(); tok {
+	case "-", "+":
+		e.pos++
+		v, err := e.factor()
+		if err != nil || tok == "+" {
+			return v, err
+		}
+		return e.negate(v)
+	case "(":
+		e.pos++
+		v, err := e.expr()
+		if err != nil {
+			return exprValue{}, err
+		}
+		if e.peek() != ")" {
+			return exprValue{}, fmt.Errorf("invalid expression: %s", e.src)
+		}
+		e.pos++
+		return v, nil
+	case "", ")", "*", "/":
+		return exprValue{}, fmt.Errorf("invalid expression: %s", e.src)
+	default:
+		e.pos++
+		if n, err := strconv.ParseFloat(tok, 64); err == nil {
+			return exprValue{n: n}, nil
+		}
+		d, err := e.p.Parse(tok)
+		if err != nil {
+			return exprValue{}, err
+		}
+		return exprValue{d: d, duration: true}, nil
+	}
+}
+
+func (e *exprParser) negate(v exprValue) (exprValue, error) {
+	if !v.duration {
+		return exprValue{n: -v.n}, nil
+	}
+	if v.d == math.MinInt64 {
+		return exprValue{}, fmt.Errorf("duration out of range: %s", e.src)
+	}
+	return exprValue{d: -v.d, duration: true}, nil
+}
+
+func (e *exprParser) add(v, w exprValue) (exprValue, error) {
+	if !v.duration && !w.duration {
+		return exprValue{n: v.n + w.n}, nil
+	}
+	a, err := e.toDuration(v)
+	if err != nil {
+		return exprValue{}, err
+	}
+	b, err := e.toDuration(w)
+	if err != nil {
+		return exprValue{}, err
+	}
+	if (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b) {
+		return exprValue{}, fmt.Errorf("duration out of range: %s", e.src)
+	}
+	return exprValue{d: a + b, duration: true}, nil
+}
+
+func (e *exprParser) mul(v, w exprValue) (exprValue, error) {
+	switch {
+	case v.duration && w.duration:
+		return exprValue{}, fmt.Errorf("cannot multiply two durations: %s", e.src)
+	case v.duration:
+		return e.scale(v.d, w.n)
+	case w.duration:
+		return e.scale(w.d, v.n)
+	default:
+		return exprValue{n: v.n * w.n}, nil
+	}
+}
+
+func (e *exprParser) div(v, w exprValue) (exprValue, error) {
+	if (w.duration && w.d == 0) || (!w.duration && w.n == 0) {
+		return exprValue{}, fmt.Errorf("division by zero: %s", e.src)
+	}
+	switch {
+	case v.duration && w.duration:
+		return exprValue{n: float64(v.d) / float64(w.d)}, nil
+	case v.duration:
+		return e.scale(v.d, 1/w.n)
+	case w.duration:
+		return exprValue{}, fmt.Errorf("cannot divide by a duration: %s", e.src)
+	default:
+		return exprValue{n: v.n / w.n}, nil
+	}
+}
+
+// scale multiplies d by f, failing rather than overflowing.
+func (e *exprParser) scale(d time.Duration, f float64) (exprValue, error) {
+	ns := math.Round(float64(d) * f)
+	if math.IsNaN(ns) || ns >= math.MaxInt64 || ns < math.MinInt64 {
+		return exprValue{}, fmt.Errorf("duration out of range: %s", e.src)
+	}
+	return exprValue{d: time.Duration(ns), duration: true}, nil
+}
+
+// toDuration returns v as a duration, reading a plain number in the default
+// unit.
+func (e *exprParser) toDuration(v exprValue) (time.Duration, error) {
+	if v.duration {
+		return v.d, nil
+	}
+	// Zero is zero in any unit, so it needs none, even under StrictUnits.
+	if v.n == 0 {
+		return 0, nil
+	}
+	if e.p.StrictUnits {
+		return 0, fmt.Errorf("missing unit in %s (give every term a unit)", e.src)
+	}
+	unit, err := e.p.Parse("1")
+	if err != nil {
+		return 0, err
+	}
+	r, err := e.scale(unit, v.n)
+	return r.d, err
+}
@@ -0,0 +1,66 @@
+package jitter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpression(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10s*3", 30 * time.Second, false},
+		{"3*10s", 30 * time.Second, false},
+		{"1m+30s", 90 * time.Second, false},
+		{"(1m+30s)/2", 45 * time.Second, false},
+		{"1m+30s/2", 75 * time.Second, false},
+		{"1m - 30s * 2", 0, false},
+		{"2h-3h", -time.Hour, false},
+		{"-(1m+30s)+2m", 30 * time.Second, false},
+		{"1h/4m", 15 * time.Second, false},
+		{"10+5", 15 * time.Second, false},
+		{"1m+30", 90 * time.Second, false},
+		{"1.5*1d", 36 * time.Hour, false},
+		{"1,500ms*2", 3 * time.Second, false},
+		{"((10s))", 10 * time.Second, false},
+		{"1e-3d+1s", 87400 * time.Millisecond, false},
+		{"2*1e+1d", 480 * time.Hour, false},
+		{"10s/0", 0, true},
+		{"10s/(1m-1m)", 0, true},
+		{"10s*10s", 0, true},
+		{"10/10s", 0, true},
+		{"(1m+30s", 0, true},
+		{"1m+30s)", 0, true},
+		{"1m+", 0, true},
+		{"*1m", 0, true},
+		{"1m++", 0, true},
+		{"2540400h+2540400h", 0, true},
+		{"2540400h*2", 0, true},
+		{"1m+abc", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDuration(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionDefaultUnit(t *testing.T) {
+	got, err := DurationParser{DefaultUnit: "ms"}.Parse("100*3")
+	if err != nil {
+		t.Fatalf("Parse unexpected error: %v", err)
+	}
+	if got != 300*time.Millisecond {
+		t.Errorf("Parse(%q) = %v, want 300ms", "100*3", got)
+	}
+}
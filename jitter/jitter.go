@@ -0,0 +1,423 @@
+// Package jitter computes and samples jittered durations.
+package jitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// DefaultFraction is the jitter applied in each direction when none is
+// given.
+const DefaultFraction = 0.5
+
+// Supported sampling distributions.
+const (
+	Uniform     = "uniform"
+	Normal      = "normal"
+	Triangular  = "triangular"
+	Exponential = "exponential"
+)
+
+// Ways Clamp can bring an interval within Min and Max.
+const (
+	// Clip cuts off whatever lies outside the bounds, narrowing the
+	// interval. It is the default.
+	Clip = "clip"
+	// Shift slides the whole interval, keeping its width, until it fits,
+	// clipping only what is still outside if it's wider than the bounds.
+	Shift = "shift"
+)
+
+// Ways spread can apply Down and Up to the base.
+const (
+	// Additive extends the interval by the fractions of the base, to
+	// [base*(1-Down), base*(1+Up)]. It is the default.
+	Additive = "additive"
+	// Multiplicative scales the base by the fractions, to
+	// [base/(1+Down), base*(1+Up)], so equal fractions keep the geometric
+	// mean of the ends at base and the low end never reaches zero.
+	Multiplicative = "multiplicative"
+)
+
+// ErrEmptyInterval is returned when clamping leaves no durations to choose
+// from.
+var ErrEmptyInterval = errors.New("defined interval is empty after clamping")
+
+// Options controls how a base duration is widened into an interval and how
+// that interval is sampled. The zero value applies no jitter and samples
+// uniformly with crypto/rand.
+type Options struct {
+	// Down and Up are the fractions of the base the interval extends below
+	// and above it.
+	Down, Up float64
+
+	// JitterMode is how Down and Up are applied, Additive or
+	// Multiplicative; empty means Additive.
+	JitterMode string
+
+	// MaxDelta, if positive, caps how far Down and Up can move either end
+	// of the interval from the base, as in "20% but at most 3s".
+	MaxDelta time.Duration
+
+	// Range, if non-zero, is an absolute amount the interval extends on each
+	// side of the base, used instead of Down and Up.
+	Range time.Duration
+
+	// Minus and Plus, if either is non-zero, are absolute amounts the
+	// interval extends below and above the base, used instead of Down and
+	// Up.
+	Minus, Plus time.Duration
+
+	// MaxWidth, if positive, caps high-low: a wider interval is narrowed
+	// to MaxWidth around its midpoint before any offset or clamping.
+	MaxWidth time.Duration
+
+	// Offset shifts the whole interval, and the base the Triangular
+	// distribution peaks at, by a fixed amount before clamping. It may be
+	// negative.
+	Offset time.Duration
+
+	// Min and Max, if non-nil, clamp the interval.
+	Min, Max *time.Duration
+
+	// ClampMode is how Min and Max are applied, Clip or Shift; empty means
+	// Clip.
+	ClampMode string
+
+	// Dist is the sampling distribution; empty means Uniform.
+	Dist string
+
+	// Source supplies randomness; nil means CryptoSource.
+	Source Source
+}
+
+// Jitter samples a duration from the interval opts builds around base.
+func Jitter(base time.Duration, opts Options) (time.Duration, error) {
+	low, high, err := Bounds(base, opts)
+	if err != nil {
+		return 0, err
+	}
+	return ChooseSleepDurationAround(low, high, base+opts.Offset, opts.Dist, opts.Source)
+}
+
+// SleepContext samples a duration like Jitter and sleeps for it. If ctx is
+// done first it returns early with ctx.Err(); otherwise it returns the
+// duration it slept.
+func SleepContext(ctx context.Context, base time.Duration, opts Options) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	d, err := Jitter(base, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return d, nil
+	case <-ctx.Done():
+		return d, ctx.Err()
+	}
+}
+
+// Bounds returns the interval around base described by opts, after clamping.
+func Bounds(base time.Duration, opts Options) (low, high time.Duration, err error) {
+	if low, high, err = Interval(base, opts); err != nil {
+		return 0, 0, err
+	}
+	return Clamp(low, high, opts)
+}
+
+// Interval returns the interval around base described by opts before any
+// clamping, so low may be negative.
+func Interval(base time.Duration, opts Options) (low, high time.Duration, err error) {
+	if low, high, err = spread(base, opts); err != nil {
+		return 0, 0, err
+	}
+	if opts.MaxWidth > 0 {
+		low, high = capWidth(low, high, opts.MaxWidth)
+	}
+	if (opts.Offset > 0 && high > math.MaxInt64-opts.Offset) || (opts.Offset < 0 && low < math.MinInt64-opts.Offset) {
+		return 0, 0, errors.New("offset results overflow time.Duration")
+	}
+	return low + opts.Offset, high + opts.Offset, nil
+}
+
+// spread widens base into an interval by opts.Range, by opts.Minus and
+// opts.Plus, or by opts.Down and opts.Up.
+func spread(base time.Duration, opts Options) (low, high time.Duration, err error) {
+	if opts.Range != 0 {
+		return base - opts.Range, base + opts.Range, nil
+	}
+	if opts.Minus != 0 || opts.Plus != 0 {
+		return base - opts.Minus, base + opts.Plus, nil
+	}
+
+	baseNs := float64(base.Nanoseconds())
+	var lowNs, highNs float64
+	switch opts.JitterMode {
+	case Additive, "":
+		deltaDown, deltaUp := math.Round(baseNs*opts.Down), math.Round(baseNs*opts.Up)
+		if math.IsNaN(deltaDown) || math.IsInf(deltaDown, 0) || math.IsNaN(deltaUp) || math.IsInf(deltaUp, 0) {
+			return 0, 0, errors.New("jitter results overflow time.Duration")
+		}
+		lowNs, highNs = baseNs-deltaDown, baseNs+deltaUp
+	case Multiplicative:
+		lowNs, highNs = math.Round(baseNs/(1+opts.Down)), math.Round(baseNs*(1+opts.Up))
+		if math.IsNaN(lowNs) || math.IsNaN(highNs) {
+			return 0, 0, errors.New("jitter results overflow time.Duration")
+		}
+	default:
+		return 0, 0, fmt.Errorf("unknown jitter mode: %s", opts.JitterMode)
+	}
+	if opts.MaxDelta > 0 {
+		d := float64(opts.MaxDelta)
+		lowNs, highNs = max(lowNs, baseNs-d), min(highNs, baseNs+d)
+	}
+	if lowNs < math.MinInt64 || lowNs > math.MaxInt64 || highNs < math.MinInt64 || highNs > math.MaxInt64 {
+		return 0, 0, errors.New("jitter results overflow time.Duration")
+	}
+	return time.Duration(lowNs), time.Duration(highNs), nil
+}
+
+// capWidth narrows [low, high] to width around its midpoint if it is any
+// wider. The width is computed unsigned so that it can't overflow.
+func capWidth(low, high, width time.Duration) (time.Duration, time.Duration) {
+	w := uint64(high) - uint64(low)
+	if w <= uint64(width) {
+		return low, high
+	}
+	mid := low + time.Duration(w/2)
+	low = mid - width/2
+	return low, low + width
+}
+
+// Clamp applies opts.Min and opts.Max to [low, high] as opts.ClampMode says
+// and then floors both ends at zero. Clamping never widens the interval.
+func Clamp(low, high time.Duration, opts Options) (time.Duration, time.Duration, error) {
+	if opts.Min != nil && opts.Max != nil && *opts.Max < *opts.Min {
+		return 0, 0, errors.New("max must be greater than or equal to min")
+	}
+
+	switch opts.ClampMode {
+	case Clip, "":
+	case Shift:
+		if opts.Min != nil && low < *opts.Min {
+			d := *opts.Min - low
+			low, high = *opts.Min, high+min(d, math.MaxInt64-high)
+		}
+		if opts.Max != nil && high > *opts.Max {
+			low, high = low-(high-*opts.Max), *opts.Max
+		}
+	default:
+		return 0, 0, fmt.Errorf("unknown clamp mode: %s", opts.ClampMode)
+	}
+
+	if opts.Min != nil {
+		low, high = max(low, *opts.Min), max(high, *opts.Min)
+	}
+	if opts.Max != nil {
+		low, high = min(low, *opts.Max), min(high, *opts.Max)
+	}
+	low, high = max(low, 0), max(high, 0)
+
+	if high < low {
+		return 0, 0, ErrEmptyInterval
+	}
+	return low, high, nil
+}
+
+// ChooseSleepDuration samples a duration from [low, high] using dist and src,
+// centering the Triangular and Exponential distributions on the midpoint.
+// An empty dist means Uniform and a nil src means CryptoSource.
+func ChooseSleepDuration(low, high time.Duration, dist string, src Source) (time.Duration, error) {
+	mid := low + time.Duration((uint64(high)-uint64(low))/2)
+	return ChooseSleepDurationAround(low, high, mid, dist, src)
+}
+
+// ChooseSleepDurationAround is ChooseSleepDuration with base in place of the
+// midpoint: base is where the Triangular distribution peaks and the
+// Exponential distribution's mean, moved into the interval if clamping left
+// it outside; other distributions ignore it.
+func ChooseSleepDurationAround(low, high, base time.Duration, dist string, src Source) (time.Duration, error) {
+	if high == low {
+		return max(low, 0), nil
+	}
+
+	if low > high {
+		return 0, errors.New("low must be less than or equal to high")
+	}
+
+	if src == nil {
+		src = CryptoSource{}
+	}
+	d, err := sampleDistribution(low, high, min(max(base, low), high), dist, src)
+	if err != nil {
+		return 0, err
+	}
+	return max(d, 0), nil
+}
+
+// Quantile returns the duration at fraction p, from 0 to 1, of dist over
+// [low, high] without drawing anything: for example p of 0.5 is the median.
+// base is used as for ChooseSleepDurationAround.
+func Quantile(low, high, base time.Duration, dist string, p float64) (time.Duration, error) {
+	if low > high {
+		return 0, errors.New("low must be less than or equal to high")
+	}
+	if math.IsNaN(p) || p < 0 || p > 1 {
+		return 0, fmt.Errorf("quantile out of range: %g", p)
+	}
+	a, b := float64(low), float64(high)
+	var x float64
+	switch dist {
+	case Uniform, "":
+		x = a + (b-a)*p
+	case Normal:
+		// The inverse of the normal CDF sampleNormal draws from.
+		x = a + (b-a)/2 + (b-a)/6*math.Sqrt2*math.Erfinv(2*p-1)
+	case Triangular:
+		x = triangularQuantile(a, b, float64(min(max(base, low), high)), p)
+	case Exponential:
+		x = exponentialQuantile(float64(min(max(base, low), high)), p)
+	default:
+		return 0, fmt.Errorf("unknown distribution: %s", dist)
+	}
+	return max(clampToInterval(x, low, high), 0), nil
+}
+
+// Chance reports true with probability p, drawing from src, or from
+// crypto/rand if src is nil. A p of 1 or more is always true and a p of 0 or
+// less always false, without drawing.
+func Chance(p float64, src Source) (bool, error) {
+	if p >= 1 {
+		return true, nil
+	}
+	if p <= 0 {
+		return false, nil
+	}
+	if src == nil {
+		src = CryptoSource{}
+	}
+	f, err := randFloat64(src)
+	if err != nil {
+		return false, err
+	}
+	return f < p, nil
+}
+
+// sampleDistribution draws a duration from [low, high] shaped by dist. The
+// caller must ensure low <= base <= high.
+func sampleDistribution(low, high, base time.Duration, dist string, src Source) (time.Duration, error) {
+	switch dist {
+	case Uniform, "":
+		return sampleUniform(low, high, src)
+	case Normal:
+		return sampleNormal(low, high, src)
+	case Triangular:
+		return sampleTriangular(low, high, base, src)
+	case Exponential:
+		return sampleExponential(low, high, base, src)
+	default:
+		return 0, fmt.Errorf("unknown distribution: %s", dist)
+	}
+}
+
+// sampleUniform works in unsigned arithmetic so that every value in
+// [low, high] is reachable, even when the width doesn't fit in an int64.
+func sampleUniform(low, high time.Duration, src Source) (time.Duration, error) {
+	// For the full int64 range width+1 wraps to 0, which Uint64n treats as
+	// the whole uint64 range.
+	width := uint64(high) - uint64(low)
+	offset, err := draw(src, width+1)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(uint64(low) + offset), nil
+}
+
+// sampleNormal centers a normal distribution on the midpoint of [low, high]
+// with the half-width spanning three standard deviations. Samples that land
+// outside the interval are clamped to it.
+func sampleNormal(low, high time.Duration, src Source) (time.Duration, error) {
+	u1, err := randFloat64(src)
+	if err != nil {
+		return 0, err
+	}
+	u2, err := randFloat64(src)
+	if err != nil {
+		return 0, err
+	}
+
+	// Box-Muller; 1-u1 keeps the logarithm's argument in (0, 1].
+	z := math.Sqrt(-2*math.Log(1-u1)) * math.Cos(2*math.Pi*u2)
+
+	lowNs, highNs := float64(low), float64(high)
+	mean := lowNs + (highNs-lowNs)/2
+	stddev := (highNs - lowNs) / 6
+	return clampToInterval(mean+z*stddev, low, high), nil
+}
+
+// sampleTriangular draws from a triangular distribution over [low, high]
+// peaking at mode, using the inverse CDF.
+func sampleTriangular(low, high, mode time.Duration, src Source) (time.Duration, error) {
+	u, err := randFloat64(src)
+	if err != nil {
+		return 0, err
+	}
+
+	return clampToInterval(triangularQuantile(float64(low), float64(high), float64(mode), u), low, high), nil
+}
+
+// triangularQuantile is the inverse CDF of the triangular distribution over
+// [a, b] peaking at c.
+func triangularQuantile(a, b, c, u float64) float64 {
+	if u < (c-a)/(b-a) {
+		return a + math.Sqrt(u*(b-a)*(c-a))
+	}
+	return b - math.Sqrt((1-u)*(b-a)*(b-c))
+}
+
+// sampleExponential draws from an exponential distribution with the given
+// mean, as for the gaps between events of a Poisson process, clamped to
+// [low, high].
+func sampleExponential(low, high, mean time.Duration, src Source) (time.Duration, error) {
+	u, err := randFloat64(src)
+	if err != nil {
+		return 0, err
+	}
+	return clampToInterval(exponentialQuantile(float64(mean), u), low, high), nil
+}
+
+// exponentialQuantile is the inverse CDF of the exponential distribution with
+// the given mean. For u in [0, 1) Log1p(-u) is finite, and Log1p stays
+// accurate for the small u that produce the shortest sleeps.
+func exponentialQuantile(mean, u float64) float64 {
+	return -mean * math.Log1p(-u)
+}
+
+// clampToInterval rounds ns to a Duration within [low, high].
+func clampToInterval(ns float64, low, high time.Duration) time.Duration {
+	if math.IsNaN(ns) || ns <= float64(low) {
+		return low
+	}
+	if ns >= float64(high) {
+		return high
+	}
+	return time.Duration(math.Round(ns))
+}
+
+// randFloat64 returns a uniformly distributed float64 in [0, 1).
+func randFloat64(src Source) (float64, error) {
+	const precision = 1 << 53
+	v, err := draw(src, precision)
+	if err != nil {
+		return 0, err
+	}
+	return float64(v) / precision, nil
+}
@@ -0,0 +1,676 @@
+package jitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJitter(t *testing.T) {
+	minVal, maxVal := 9*time.Second, 14*time.Second
+	tests := []struct {
+		name    string
+		base    time.Duration
+		opts    Options
+		wantLow time.Duration
+		wantHi  time.Duration
+	}{
+		{"no jitter", 10 * time.Second, Options{}, 10 * time.Second, 10 * time.Second},
+		{"default fraction", 10 * time.Second, Options{Down: DefaultFraction, Up: DefaultFraction}, 5 * time.Second, 15 * time.Second},
+		{"asymmetric", 10 * time.Second, Options{Down: 0.1, Up: 0.5}, 9 * time.Second, 15 * time.Second},
+		{"range", 10 * time.Second, Options{Range: 2 * time.Second}, 8 * time.Second, 12 * time.Second},
+		{"delta capped", time.Minute, Options{Down: 0.5, Up: 0.5, MaxDelta: 3 * time.Second}, 57 * time.Second, 63 * time.Second},
+		{"delta capped on one side", 10 * time.Second, Options{Down: 0.1, Up: 0.5, MaxDelta: 2 * time.Second}, 9 * time.Second, 12 * time.Second},
+		{"multiplicative delta capped", 10 * time.Second, Options{Down: 1, Up: 1, JitterMode: Multiplicative, MaxDelta: 2 * time.Second}, 8 * time.Second, 12 * time.Second},
+		{"minus and plus", 10 * time.Second, Options{Minus: 2 * time.Second, Plus: 5 * time.Second}, 8 * time.Second, 15 * time.Second},
+		{"plus only", 10 * time.Second, Options{Plus: 5 * time.Second}, 10 * time.Second, 15 * time.Second},
+		{"multiplicative", 10 * time.Second, Options{Down: 1, Up: 1, JitterMode: Multiplicative}, 5 * time.Second, 20 * time.Second},
+		{"multiplicative asymmetric", 10 * time.Second, Options{Down: 0.25, Up: 0.5, JitterMode: Multiplicative}, 8 * time.Second, 15 * time.Second},
+		{"multiplicative stays above zero", 10 * time.Second, Options{Down: 9, Up: 0, JitterMode: Multiplicative}, time.Second, 10 * time.Second},
+		{"width capped", time.Hour, Options{Down: 1, Up: 1, MaxWidth: 10 * time.Minute}, 55 * time.Minute, 65 * time.Minute},
+		{"width capped asymmetric", 10 * time.Second, Options{Down: 0.1, Up: 0.5, MaxWidth: 2 * time.Second}, 11 * time.Second, 13 * time.Second},
+		{"width under cap", 10 * time.Second, Options{Range: 2 * time.Second, MaxWidth: time.Minute}, 8 * time.Second, 12 * time.Second},
+		{"offset", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Offset: 5 * time.Second}, 10 * time.Second, 20 * time.Second},
+		{"offset then clamped", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Offset: 2 * time.Second, Min: &minVal, Max: &maxVal}, 9 * time.Second, 14 * time.Second},
+		{"shifted up", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Min: &minVal, ClampMode: Shift}, 9 * time.Second, 19 * time.Second},
+		{"shifted down", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Max: &maxVal, ClampMode: Shift}, 4 * time.Second, 14 * time.Second},
+		{"shifted then clipped", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Min: &minVal, Max: &maxVal, ClampMode: Shift}, 9 * time.Second, 14 * time.Second},
+		{"clamped", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Min: &minVal, Max: &maxVal}, 9 * time.Second, 14 * time.Second},
+		{"floored at zero", 10 * time.Second, Options{Down: 2, Up: 2}, 0, 30 * time.Second},
+		{"normal", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Dist: Normal}, 5 * time.Second, 15 * time.Second},
+		{"seeded", 10 * time.Second, Options{Down: 0.5, Up: 0.5, Source: NewSeededSource(1)}, 5 * time.Second, 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			low, high, err := Bounds(tt.base, tt.opts)
+			if err != nil {
+				t.Fatalf("Bounds(%v) unexpected error: %v", tt.base, err)
+			}
+			if low != tt.wantLow || high != tt.wantHi {
+				t.Errorf("Bounds(%v) = [%v, %v], want [%v, %v]", tt.base, low, high, tt.wantLow, tt.wantHi)
+			}
+
+			for i := 0; i < 100; i++ {
+				got, err := Jitter(tt.base, tt.opts)
+				if err != nil {
+					t.Fatalf("Jitter(%v) unexpected error: %v", tt.base, err)
+				}
+				if got < tt.wantLow || got > tt.wantHi {
+					t.Fatalf("Jitter(%v) = %v, want in [%v, %v]", tt.base, got, tt.wantLow, tt.wantHi)
+				}
+			}
+		})
+	}
+
+	t.Run("interval is unclamped", func(t *testing.T) {
+		low, high, err := Interval(10*time.Second, Options{Down: 2, Up: 2, Min: &minVal})
+		if err != nil {
+			t.Fatalf("Interval unexpected error: %v", err)
+		}
+		if low != -10*time.Second || high != 30*time.Second {
+			t.Errorf("Interval = [%v, %v], want [-10s, 30s]", low, high)
+		}
+	})
+
+	t.Run("offset overflow", func(t *testing.T) {
+		if _, _, err := Interval(math.MaxInt64-time.Second, Options{Offset: 2 * time.Second}); err == nil {
+			t.Error("expected overflow error")
+		}
+	})
+
+	t.Run("empty after clamping", func(t *testing.T) {
+		if _, _, err := Clamp(10*time.Second, 5*time.Second, Options{}); !errors.Is(err, ErrEmptyInterval) {
+			t.Errorf("Clamp error = %v, want ErrEmptyInterval", err)
+		}
+	})
+
+	t.Run("unknown clamp mode", func(t *testing.T) {
+		if _, _, err := Clamp(0, time.Second, Options{ClampMode: "squash"}); err == nil {
+			t.Error("expected error for unknown clamp mode")
+		}
+	})
+
+	t.Run("unknown jitter mode", func(t *testing.T) {
+		if _, _, err := Interval(time.Second, Options{JitterMode: "sideways"}); err == nil {
+			t.Error("expected error for unknown jitter mode")
+		}
+	})
+
+	t.Run("max below min", func(t *testing.T) {
+		opts := Options{Min: &maxVal, Max: &minVal}
+		if _, err := Jitter(10*time.Second, opts); err == nil {
+			t.Error("expected error when max < min")
+		}
+	})
+}
+
+func TestSleepContext(t *testing.T) {
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		if _, err := SleepContext(ctx, time.Hour, Options{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("SleepContext error = %v, want context.Canceled", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("SleepContext took %v with a cancelled context", elapsed)
+		}
+	})
+
+	t.Run("cancelled while sleeping", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := SleepContext(ctx, time.Hour, Options{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("SleepContext error = %v, want context.DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("completes", func(t *testing.T) {
+		start := time.Now()
+		got, err := SleepContext(context.Background(), 20*time.Millisecond, Options{Down: 0.5, Up: 0.5})
+		if err != nil {
+			t.Fatalf("SleepContext unexpected error: %v", err)
+		}
+		if got < 10*time.Millisecond || got > 30*time.Millisecond {
+			t.Errorf("SleepContext = %v, want in [10ms, 30ms]", got)
+		}
+		if elapsed := time.Since(start); elapsed < got {
+			t.Errorf("SleepContext returned after %v, before the chosen %v", elapsed, got)
+		}
+	})
+}
+
+func TestChooseSleepDuration(t *testing.T) {
+	t.Run("equal bounds", func(t *testing.T) {
+		got, err := ChooseSleepDuration(5*time.Second, 5*time.Second, Uniform, CryptoSource{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != 5*time.Second {
+			t.Errorf("got %v, want 5s", got)
+		}
+	})
+
+	t.Run("in bounds", func(t *testing.T) {
+		low := 5 * time.Second
+		high := 15 * time.Second
+		for i := 0; i < 100; i++ {
+			got, err := ChooseSleepDuration(low, high, Uniform, CryptoSource{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got < low || got > high {
+				t.Errorf("iteration %d: got %v, want in [%v, %v]", i, got, low, high)
+			}
+		}
+	})
+
+	t.Run("non-negative", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			got, err := ChooseSleepDuration(0, 10*time.Second, Uniform, CryptoSource{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got < 0 {
+				t.Errorf("iteration %d: got %v < 0", i, got)
+			}
+		}
+	})
+}
+
+// fixedSource always returns the same raw draw, reduced into range.
+type fixedSource uint64
+
+func (f fixedSource) Uint64n(n uint64) (uint64, error) {
+	if n == 0 {
+		return uint64(f), nil
+	}
+	return uint64(f) % n, nil
+}
+
+func TestChooseSleepDurationExtremes(t *testing.T) {
+	tests := []struct {
+		name      string
+		low, high time.Duration
+	}{
+		{"zero to max", 0, math.MaxInt64},
+		{"near max", math.MaxInt64 - 10, math.MaxInt64},
+		{"full range", math.MinInt64, math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got, err := ChooseSleepDuration(tt.low, tt.high, Uniform, CryptoSource{})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got < max(tt.low, 0) || got > tt.high {
+					t.Fatalf("got %v, want in [%v, %v]", got, tt.low, tt.high)
+				}
+			}
+		})
+	}
+
+	t.Run("high reachable at max width", func(t *testing.T) {
+		got, err := ChooseSleepDuration(0, math.MaxInt64, Uniform, fixedSource(math.MaxInt64))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != math.MaxInt64 {
+			t.Errorf("got %v, want %v", got, time.Duration(math.MaxInt64))
+		}
+	})
+
+	t.Run("low reachable near max", func(t *testing.T) {
+		got, err := ChooseSleepDuration(math.MaxInt64-10, math.MaxInt64, Uniform, fixedSource(0))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != math.MaxInt64-10 {
+			t.Errorf("got %v, want %v", got, time.Duration(math.MaxInt64-10))
+		}
+	})
+}
+
+func TestSeededSourceReproducible(t *testing.T) {
+	low := 5 * time.Second
+	high := 15 * time.Second
+
+	for _, dist := range []string{Uniform, Normal, Triangular} {
+		t.Run(dist, func(t *testing.T) {
+			a, b := NewSeededSource(42), NewSeededSource(42)
+			c, d := NewPCGSource(42), NewPCGSource(42)
+			for i := 0; i < 10; i++ {
+				gotA, err := ChooseSleepDuration(low, high, dist, a)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				gotB, err := ChooseSleepDuration(low, high, dist, b)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if gotA != gotB {
+					t.Errorf("draw %d: seeded runs differ: %v != %v", i, gotA, gotB)
+				}
+				gotC, err := ChooseSleepDuration(low, high, dist, c)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				gotD, err := ChooseSleepDuration(low, high, dist, d)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if gotC != gotD {
+					t.Errorf("draw %d: PCG runs differ: %v != %v", i, gotC, gotD)
+				}
+			}
+		})
+	}
+
+}
+
+// TestSeededSourceSequence pins --rng math to math/rand's Int63n, so a
+// given --seed keeps producing the durations it always has.
+func TestSeededSourceSequence(t *testing.T) {
+	low, high := 5*time.Second, 15*time.Second
+	src, ref := NewSeededSource(42), mathrand.New(mathrand.NewSource(42))
+	for i := range 10 {
+		got, err := ChooseSleepDuration(low, high, Uniform, src)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := low + time.Duration(ref.Int63n(int64(high-low)+1)); got != want {
+			t.Errorf("draw %d = %v, want %v", i, got, want)
+		}
+	}
+}
+
+type failingSource struct{}
+
+func (failingSource) Uint64n(uint64) (uint64, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestRandomnessErrors(t *testing.T) {
+	for _, dist := range []string{Uniform, Normal, Triangular, Exponential} {
+		_, err := ChooseSleepDuration(0, time.Second, dist, failingSource{})
+		if !errors.Is(err, ErrRandomness) {
+			t.Errorf("%s: error = %v, want ErrRandomness", dist, err)
+		}
+	}
+
+	_, err := uniformUint64(3, DefaultRetries, nil, func() (uint64, error) { return ^uint64(0), nil })
+	if !errors.Is(err, ErrRandomness) {
+		t.Errorf("exhausted retries: error = %v, want ErrRandomness", err)
+	}
+}
+
+// countingReader always reads as all ones, which is past the rejection
+// limit for any bound that isn't a power of two, and counts its reads.
+type countingReader struct{ reads int }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	for i := range p {
+		p[i] = 0xff
+	}
+	return len(p), nil
+}
+
+func TestCryptoRetries(t *testing.T) {
+	for _, retries := range []int{1, 5, DefaultRetries} {
+		r := new(countingReader)
+		_, err := cryptoRandUint64(r, 3, retries, nil)
+		if !errors.Is(err, ErrRandomness) {
+			t.Fatalf("retries %d: error = %v, want ErrRandomness", retries, err)
+		}
+		if r.reads != retries {
+			t.Errorf("retries %d: made %d reads", retries, r.reads)
+		}
+		if want := fmt.Sprintf("after %d attempts", retries); !strings.Contains(err.Error(), want) {
+			t.Errorf("retries %d: error %q doesn't mention %q", retries, err, want)
+		}
+	}
+}
+
+func TestCryptoSourceReader(t *testing.T) {
+	entropy := binary.LittleEndian.AppendUint64(nil, 1234)
+	src := CryptoSource{Reader: bytes.NewReader(entropy)}
+	got, err := ChooseSleepDuration(0, time.Second, Uniform, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 1234 {
+		t.Errorf("ChooseSleepDuration from fixed entropy = %v, want 1.234µs", got)
+	}
+
+	if _, err := ChooseSleepDuration(0, time.Second, Uniform, src); !errors.Is(err, ErrRandomness) {
+		t.Errorf("ChooseSleepDuration after the entropy ran out: error = %v, want ErrRandomness", err)
+	}
+}
+
+// TestAttempts checks that Attempts counts the draws each Source rejects as
+// well as the one it keeps. Just over half of the raw draws for a bound of
+// 2^62+1 fall past the rejection limit.
+func TestAttempts(t *testing.T) {
+	const values, n = 100, 1<<62 + 1
+	tests := map[string]func(*uint64) Source{
+		"crypto": func(a *uint64) Source { return CryptoSource{Attempts: a} },
+		"math": func(a *uint64) Source {
+			src := NewSeededSource(1)
+			src.Attempts = a
+			return src
+		},
+		"pcg": func(a *uint64) Source {
+			src := NewPCGSource(1)
+			src.Attempts = a
+			return src
+		},
+	}
+	for name, newSource := range tests {
+		t.Run(name, func(t *testing.T) {
+			var attempts uint64
+			src := newSource(&attempts)
+			for range values {
+				if _, err := src.Uint64n(n); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if attempts <= values {
+				t.Errorf("%d values took %d attempts, want more", values, attempts)
+			}
+		})
+	}
+
+	t.Run("reader", func(t *testing.T) {
+		entropy := append(bytes.Repeat([]byte{0xff}, 8), binary.LittleEndian.AppendUint64(nil, 7)...)
+		var attempts uint64
+		got, err := CryptoSource{Reader: bytes.NewReader(entropy), Attempts: &attempts}.Uint64n(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 1 || attempts != 2 {
+			t.Errorf("Uint64n(3) = %d after %d attempts, want 1 after 2", got, attempts)
+		}
+	})
+}
+
+func TestSourcesInRange(t *testing.T) {
+	sources := map[string]Source{
+		"crypto": CryptoSource{},
+		"math":   NewSeededSource(1),
+		"pcg":    NewPCGSource(1),
+	}
+	low, high := 5*time.Second, 15*time.Second
+
+	for name, src := range sources {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				got, err := ChooseSleepDuration(low, high, Uniform, src)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got < low || got > high {
+					t.Fatalf("draw %d = %v, want in [%v, %v]", i, got, low, high)
+				}
+
+				v, err := src.Uint64n(7)
+				if err != nil {
+					t.Fatalf("Uint64n unexpected error: %v", err)
+				}
+				if v >= 7 {
+					t.Fatalf("Uint64n(7) = %d", v)
+				}
+			}
+		})
+	}
+}
+
+// TestSampleUniformEndpoints checks that uniform sampling of a small interval
+// reaches both ends and is flat: a chi-square statistic over the ten values
+// of [0ns, 9ns] must stay below 27.88, the 0.1% critical value for nine
+// degrees of freedom. The seeded sources make the statistic deterministic;
+// crypto/rand is only checked for reaching every value.
+func TestSampleUniformEndpoints(t *testing.T) {
+	const low, high = 0, 9
+	const samples = 100000
+	sources := map[string]Source{
+		"crypto": CryptoSource{},
+		"math":   NewSeededSource(1),
+		"pcg":    NewPCGSource(1),
+	}
+
+	for name, src := range sources {
+		t.Run(name, func(t *testing.T) {
+			var counts [high - low + 1]int
+			for i := 0; i < samples; i++ {
+				got, err := ChooseSleepDuration(low, high, Uniform, src)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got < low || got > high {
+					t.Fatalf("draw %d = %v, want in [%v, %v]", i, got, time.Duration(low), time.Duration(high))
+				}
+				counts[got-low]++
+			}
+
+			expected := float64(samples) / float64(len(counts))
+			var chi2 float64
+			for v, n := range counts {
+				if n == 0 {
+					t.Errorf("%v was never drawn", time.Duration(low+v))
+				}
+				chi2 += (float64(n) - expected) * (float64(n) - expected) / expected
+			}
+			if _, isCrypto := src.(CryptoSource); !isCrypto && chi2 > 27.88 {
+				t.Errorf("chi-square = %.2f over counts %v, want below 27.88", chi2, counts)
+			}
+		})
+	}
+}
+
+func TestSampleDistribution(t *testing.T) {
+	const samples = 20000
+	low := 5 * time.Second
+	high := 15 * time.Second
+	mid := low + (high-low)/2
+
+	for _, dist := range []string{Uniform, Normal, Triangular} {
+		t.Run(dist, func(t *testing.T) {
+			var sum float64
+			for i := 0; i < samples; i++ {
+				got, err := sampleDistribution(low, high, mid, dist, CryptoSource{})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got < low || got > high {
+					t.Fatalf("sample %d: got %v, want in [%v, %v]", i, got, low, high)
+				}
+				sum += float64(got)
+			}
+
+			mean := time.Duration(sum / samples)
+			if diff := (mean - mid).Abs(); diff > 100*time.Millisecond {
+				t.Errorf("mean = %v, want within 100ms of %v", mean, mid)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		if _, err := sampleDistribution(low, high, mid, "poisson", CryptoSource{}); err == nil {
+			t.Error("expected error for unknown distribution")
+		}
+	})
+}
+
+func TestSampleExponential(t *testing.T) {
+	const samples = 50000
+	mean := 10 * time.Second
+
+	var sum float64
+	for i := 0; i < samples; i++ {
+		got, err := ChooseSleepDurationAround(0, math.MaxInt64, mean, Exponential, CryptoSource{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got < 0 {
+			t.Fatalf("sample %d: got negative %v", i, got)
+		}
+		sum += float64(got)
+	}
+
+	// The standard error of the mean is mean/sqrt(samples), about 0.45%.
+	if got := time.Duration(sum / samples); (got - mean).Abs() > mean*3/100 {
+		t.Errorf("mean = %v, want within 3%% of %v", got, mean)
+	}
+
+	t.Run("extremes", func(t *testing.T) {
+		for _, v := range []uint64{0, 1<<53 - 1} {
+			got, err := sampleExponential(time.Second, time.Minute, mean, fixedSource(v))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got < time.Second || got > time.Minute {
+				t.Errorf("draw %d = %v, want clamped into [1s, 1m]", v, got)
+			}
+		}
+	})
+}
+
+func TestChance(t *testing.T) {
+	const trials = 20000
+	src := NewSeededSource(1)
+	for _, p := range []float64{0, 0.1, 0.3, 0.5, 1} {
+		var hits int
+		for i := 0; i < trials; i++ {
+			ok, err := Chance(p, src)
+			if err != nil {
+				t.Fatalf("Chance(%v) unexpected error: %v", p, err)
+			}
+			if ok {
+				hits++
+			}
+		}
+		// Three standard deviations is at most about 1% at this many trials.
+		if got := float64(hits) / trials; math.Abs(got-p) > 0.015 {
+			t.Errorf("Chance(%v) was true %.3f of the time", p, got)
+		}
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	low, high := 5*time.Second, 15*time.Second
+	tests := []struct {
+		name    string
+		dist    string
+		base    time.Duration
+		p       float64
+		want    time.Duration
+		wantErr bool
+	}{
+		{"uniform low", Uniform, 10 * time.Second, 0, low, false},
+		{"uniform high", Uniform, 10 * time.Second, 1, high, false},
+		{"uniform midpoint", Uniform, 10 * time.Second, 0.5, 10 * time.Second, false},
+		{"uniform quarter", "", 10 * time.Second, 0.25, 7500 * time.Millisecond, false},
+		{"normal median", Normal, 10 * time.Second, 0.5, 10 * time.Second, false},
+		{"normal low", Normal, 10 * time.Second, 0, low, false},
+		{"normal high", Normal, 10 * time.Second, 1, high, false},
+		{"triangular median", Triangular, 10 * time.Second, 0.5, 10 * time.Second, false},
+		{"triangular mode at low", Triangular, low, 0.75, 10 * time.Second, false},
+		{"exponential median", Exponential, 2 * time.Second, 0.5, low, false},
+		{"too large", Uniform, 0, 1.5, 0, true},
+		{"negative", Uniform, 0, -0.1, 0, true},
+		{"unknown dist", "zipf", 0, 0.5, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Quantile(low, high, tt.base, tt.dist, tt.p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Quantile(%v) error = %v, wantErr %v", tt.p, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Quantile(%s, %v) = %v, want %v", tt.dist, tt.p, got, tt.want)
+			}
+		})
+	}
+
+	// The median of an exponential is its mean times ln 2.
+	if got, err := Quantile(0, time.Hour, 10*time.Second, Exponential, 0.5); err != nil || got != 6931471806*time.Nanosecond {
+		t.Errorf("exponential median = %v, %v, want 6.931471806s", got, err)
+	}
+}
+
+func TestSampleTriangularMode(t *testing.T) {
+	const samples = 20000
+	low, high, mode := time.Duration(0), 10*time.Second, 2*time.Second
+	window := 500 * time.Millisecond
+
+	var nearMode, nearLow, nearHigh int
+	var sum float64
+	for i := 0; i < samples; i++ {
+		got, err := ChooseSleepDurationAround(low, high, mode, Triangular, CryptoSource{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got < low || got > high {
+			t.Fatalf("sample %d: got %v, want in [%v, %v]", i, got, low, high)
+		}
+		switch {
+		case (got - mode).Abs() <= window:
+			nearMode++
+		case got-low <= window:
+			nearLow++
+		case high-got <= window:
+			nearHigh++
+		}
+		sum += float64(got)
+	}
+
+	if nearMode <= nearLow || nearMode <= nearHigh {
+		t.Errorf("samples near mode = %d, near low = %d, near high = %d; want the mode most frequent", nearMode, nearLow, nearHigh)
+	}
+
+	// The mean of a triangular distribution is (low + mode + high) / 3.
+	want := (low + mode + high) / 3
+	if mean := time.Duration(sum / samples); (mean - want).Abs() > 100*time.Millisecond {
+		t.Errorf("mean = %v, want within 100ms of %v", mean, want)
+	}
+
+	t.Run("midpoint without a base", func(t *testing.T) {
+		var sum float64
+		for i := 0; i < samples; i++ {
+			got, err := ChooseSleepDuration(low, high, Triangular, CryptoSource{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sum += float64(got)
+		}
+		if mean := time.Duration(sum / samples); (mean - 5*time.Second).Abs() > 100*time.Millisecond {
+			t.Errorf("mean = %v, want within 100ms of 5s", mean)
+		}
+	})
+
+	t.Run("mode outside interval", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			got, err := ChooseSleepDurationAround(5*time.Second, 6*time.Second, time.Second, Triangular, CryptoSource{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got < 5*time.Second || got > 6*time.Second {
+				t.Fatalf("got %v, want in [5s, 6s]", got)
+			}
+		}
+	})
+}
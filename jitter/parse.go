@@ -0,0 +1,369 @@
+package jitter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// longUnits are the duration suffixes ParseDuration handles itself, on top of
+// those understood by time.ParseDuration.
+var longUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+}
+
+// ParseDuration parses a duration string. It accepts everything
+// time.ParseDuration does, plus days ("d") and weeks ("w") suffixes and ISO
+// 8601 durations such as "PT1H30M", and treats a bare number as seconds.
+// Digits may be grouped in threes with "_" or ",", as in "1,500ms", and
+// durations can be combined with + - * / and parentheses, as in "(1m+30s)/2".
+func ParseDuration(s string) (time.Duration, error) {
+	return DurationParser{}.Parse(s)
+}
+
+// DurationParser parses durations like ParseDuration with adjustable
+// handling of bare numbers and commas. The zero value behaves exactly like
+// ParseDuration.
+type DurationParser struct {
+	// DefaultUnit is the unit a bare number is in, such as "ms" or "d". It
+	// defaults to "s".
+	DefaultUnit string
+
+	// StrictUnits rejects bare numbers other than 0 instead of giving them
+	// DefaultUnit, to catch a forgotten unit.
+	StrictUnits bool
+
+	// DecimalComma reads "," as a decimal point, as in "1,5s", for locales
+	// that write numbers that way. Commas then no longer group digits.
+	DecimalComma bool
+}
+
+// Parse parses s as a duration.
+func (p DurationParser) Parse(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+
+	if p.DecimalComma {
+		s = strings.ReplaceAll(s, ",", ".")
+	}
+
+	if s[0] == 'P' {
+		return parseISO8601(s)
+	}
+
+	if isExpression(s) {
+		return p.parseExpression(s)
+	}
+
+	s, err := stripDigitGroups(s)
+	if err != nil {
+		return 0, err
+	}
+
+	// Give a number without a unit the default one.
+	if unicode.IsDigit(rune(s[len(s)-1])) {
+		if p.StrictUnits && strings.Trim(s, "+-0") != "" {
+			return 0, fmt.Errorf("missing unit in %s (add one, as in %ss or %sms)", s, s, s)
+		}
+		unit := p.DefaultUnit
+		if unit == "" {
+			unit = "s"
+		}
+		if !validUnit(unit) {
+			return 0, fmt.Errorf("unknown unit: %s", unit)
+		}
+		s += unit
+	}
+
+	// Handle units time.ParseDuration doesn't know about.
+	for _, u := range longUnits {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		numStr := strings.TrimSuffix(s, u.suffix)
+		if d, ok, err := scaleDecimal(numStr, u.unit); ok {
+			if err != nil {
+				return 0, fmt.Errorf("duration out of range: %s", s)
+			}
+			return d, nil
+		}
+
+		// Anything else, such as an exponent, falls back to floating point.
+		num, err := strconv.ParseFloat(numStr, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+
+		maxNum := float64(math.MaxInt64) / float64(u.unit)
+		if num > maxNum || num < -maxNum {
+			return 0, fmt.Errorf("duration out of range: %s", s)
+		}
+
+		return time.Duration(num * float64(u.unit)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// stripDigitGroups removes "_" and "," used as thousands separators, as in
+// "1_000s" or "1,500ms". A separator must sit in the integer part of a number
+// and be followed by exactly three digits, so "1,5s" is rejected rather than
+// read as 15s.
+func stripDigitGroups(s string) (string, error) {
+	if !strings.ContainsAny(s, "_,") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	inFraction := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_' || c == ',':
+			group := s[i+1 : min(i+4, len(s))]
+			if inFraction || i == 0 || !isDigit(s[i-1]) || len(group) != 3 ||
+				strings.Trim(group, "0123456789") != "" ||
+				(i+4 < len(s) && isDigit(s[i+4])) {
+				return "", fmt.Errorf("ambiguous digit grouping in %s: separators must be followed by groups of three digits", s)
+			}
+			continue
+		case c == '.':
+			inFraction = true
+		case !isDigit(c):
+			inFraction = false
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// errOutOfRange is returned by scaleDecimal for results that don't fit in a
+// time.Duration.
+var errOutOfRange = errors.New("duration out of range")
+
+// scaleDecimal multiplies unit by the plain decimal number s, such as "0.1" or
+// "-2.5", using integer arithmetic so that "0.1d" is exactly 2h24m. Digits
+// past the nanosecond are truncated, as time.ParseDuration does. ok is false
+// if s isn't a plain decimal; err is set if the result overflows.
+func scaleDecimal(s string, unit time.Duration) (d time.Duration, ok bool, err error) {
+	neg := false
+	if s != "" && (s[0] == '-' || s[0] == '+') {
+		neg, s = s[0] == '-', s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole+frac == "" || strings.Trim(whole+frac, "0123456789") != "" {
+		return 0, false, nil
+	}
+
+	var ns uint64
+	for i := 0; i < len(whole); i++ {
+		hi, lo := bits.Mul64(ns, 10)
+		if hi != 0 || lo > math.MaxUint64-uint64(whole[i]-'0') {
+			return 0, true, errOutOfRange
+		}
+		ns = lo + uint64(whole[i]-'0')
+	}
+	hi, ns := bits.Mul64(ns, uint64(unit))
+	if hi != 0 {
+		return 0, true, errOutOfRange
+	}
+
+	// unit is below 2^63 and the fraction below 1, so the scaled fraction
+	// fits and bits.Div64 can't overflow.
+	if frac = strings.TrimRight(frac, "0"); frac != "" {
+		frac = frac[:min(len(frac), 18)]
+		f, _ := strconv.ParseUint(frac, 10, 64)
+		scale := uint64(math.Pow10(len(frac)))
+		hi, lo := bits.Mul64(f, uint64(unit))
+		q, _ := bits.Div64(hi, lo, scale)
+		if ns+q < ns {
+			return 0, true, errOutOfRange
+		}
+		ns += q
+	}
+
+	limit := uint64(math.MaxInt64)
+	if neg {
+		limit++
+	}
+	if ns > limit {
+		return 0, true, errOutOfRange
+	}
+	if neg {
+		return time.Duration(-ns), true, nil
+	}
+	return time.Duration(ns), true, nil
+}
+
+// iso8601Designators are the components of an ISO 8601 duration in the order
+// they must appear. Years and months are recognized only to reject them.
+var iso8601Designators = []struct {
+	designator byte
+	time       bool // whether it belongs after the "T"
+	unit       time.Duration
+}{
+	{'Y', false, 0},
+	{'M', false, 0},
+	{'W', false, 7 * 24 * time.Hour},
+	{'D', false, 24 * time.Hour},
+	{'H', true, time.Hour},
+	{'M', true, time.Minute},
+	{'S', true, time.Second},
+}
+
+// parseISO8601 parses an ISO 8601 duration such as "PT1H30M" or "P1DT2H".
+func parseISO8601(s string) (time.Duration, error) {
+	rest := s[1:]
+	if rest == "" || rest == "T" || strings.HasSuffix(rest, "T") {
+		return 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+	}
+
+	var total time.Duration
+	var inTime bool
+	next := 0 // index into iso8601Designators of the earliest allowed component
+	for rest != "" {
+		if rest[0] == 'T' {
+			if inTime {
+				return 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+			}
+			inTime, rest = true, rest[1:]
+			continue
+		}
+
+		end := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+		if end <= 0 {
+			return 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+		}
+		num := rest[:end]
+		designator := rest[end]
+		rest = rest[end+1:]
+
+		i := next
+		for i < len(iso8601Designators) && (iso8601Designators[i].designator != designator || iso8601Designators[i].time != inTime) {
+			i++
+		}
+		if i == len(iso8601Designators) {
+			return 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+		}
+		next = i + 1
+
+		unit := iso8601Designators[i].unit
+		if unit == 0 {
+			return 0, fmt.Errorf("years and months have no fixed length: %s", s)
+		}
+		d, ok, err := scaleDecimal(num, unit)
+		if !ok {
+			return 0, fmt.Errorf("invalid ISO 8601 duration: %s", s)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("duration out of range: %s", s)
+		}
+		if total > math.MaxInt64-d {
+			return 0, fmt.Errorf("duration out of range: %s", s)
+		}
+		total += d
+	}
+	return total, nil
+}
+
+// validUnit reports whether unit is a suffix Parse understands.
+func validUnit(unit string) bool {
+	switch unit {
+	case "ns", "us", "µs", "μs", "ms", "s", "m", "h":
+		return true
+	}
+	for _, u := range longUnits {
+		if unit == u.suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePercent parses a non-negative percentage such as "20%" into a
+// fraction.
+func ParsePercent(s string) (float64, error) {
+	if !strings.HasSuffix(s, "%") {
+		return 0, fmt.Errorf("percent must end with %%: %s", s)
+	}
+	val, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid percent: %s", s)
+	}
+	if val < 0 {
+		return 0, errors.New("jitter cannot be negative")
+	}
+	return val / 100, nil
+}
+
+// ParseRatio parses a non-negative fraction given either as a percent such as
+// "20%" or, without the "%", as a plain ratio such as "0.2".
+func ParseRatio(s string) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		return ParsePercent(s)
+	}
+	val, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ratio or percent: %s", s)
+	}
+	if val < 0 {
+		return 0, errors.New("jitter cannot be negative")
+	}
+	return val, nil
+}
+
+// ParseJitter parses a jitter spec into downward and upward fractions. A plain
+// percent such as "20%", or ratio such as "0.2", is symmetric, while signed
+// percent components such as "+50%", "-10%", or "-10%+50%" set each direction
+// independently, leaving any direction that isn't mentioned at zero.
+func ParseJitter(s string) (down, up float64, err error) {
+	if s == "" || (s[0] != '+' && s[0] != '-') {
+		down, err = ParseRatio(s)
+		return down, down, err
+	}
+
+	var downSet, upSet bool
+	for rest := s; rest != ""; {
+		sign := rest[0]
+		if sign != '+' && sign != '-' {
+			return 0, 0, fmt.Errorf("invalid jitter: %s", s)
+		}
+		end := strings.IndexByte(rest, '%')
+		if end < 0 {
+			return 0, 0, fmt.Errorf("percent must end with %%: %s", s)
+		}
+
+		// Strip the sign ourselves so ParsePercent's negative check still
+		// catches inputs like "+-10%".
+		val, perr := ParsePercent(rest[1 : end+1])
+		if perr != nil {
+			return 0, 0, perr
+		}
+		switch {
+		case sign == '-' && !downSet:
+			down, downSet = val, true
+		case sign == '+' && !upSet:
+			up, upSet = val, true
+		default:
+			return 0, 0, fmt.Errorf("jitter direction %c given more than once: %s", sign, s)
+		}
+		rest = rest[end+1:]
+	}
+
+	if down > 1 {
+		return 0, 0, fmt.Errorf("downward jitter cannot exceed 100%%: %s", s)
+	}
+	return down, up, nil
+}
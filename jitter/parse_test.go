@@ -0,0 +1,302 @@
+package jitter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"5", 5 * time.Second, false},
+		{"100", 100 * time.Second, false},
+		{"100ms", 100 * time.Millisecond, false},
+		{"1m", time.Minute, false},
+		{"1h", time.Hour, false},
+		{"2d", 48 * time.Hour, false},
+		{"0.5d", 12 * time.Hour, false},
+		{"1.5h", 90 * time.Minute, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"0.5w", 84 * time.Hour, false},
+		{"1.5w", 252 * time.Hour, false},
+		{"0.1d", 8640 * time.Second, false},
+		{"0.25d", 6 * time.Hour, false},
+		{"0.1w", 60480 * time.Second, false},
+		{"12345.6789d", 1066666656960000000, false},
+		{"1.000000001d", 86400000086400, false},
+		{"-0.1d", -8640 * time.Second, false},
+		{"+1.d", 24 * time.Hour, false},
+		{".5d", 12 * time.Hour, false},
+		{"1e1d", 240 * time.Hour, false},
+		{"1e-3d", 86400 * time.Millisecond, false},
+		{"1E+1d", 240 * time.Hour, false},
+		{"106751d", 106751 * 24 * time.Hour, false},
+		{"106752d", 0, true},
+		{"-106752d", 0, true},
+		{"1.2.3d", 0, true},
+		{".d", 0, true},
+		{"500us", 500 * time.Microsecond, false},
+		{"500µs", 500 * time.Microsecond, false},
+		{"PT90M", 90 * time.Minute, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1DT2H", 26 * time.Hour, false},
+		{"P2W", 14 * 24 * time.Hour, false},
+		{"PT1.5S", 1500 * time.Millisecond, false},
+		{"P0.1D", 8640 * time.Second, false},
+		{"P12345.6789D", 1066666656960000000, false},
+		{"P1.2.3D", 0, true},
+		{"1_000s", 1000 * time.Second, false},
+		{"1,500ms", 1500 * time.Millisecond, false},
+		{"1,000,000ns", time.Millisecond, false},
+		{"1_000.5s", 1000*time.Second + 500*time.Millisecond, false},
+		{"1,000h30m", 1000*time.Hour + 30*time.Minute, false},
+		{"1,000", 1000 * time.Second, false},
+		{"1,5s", 0, true},
+		{"1,5000s", 0, true},
+		{"1__000s", 0, true},
+		{",500ms", 0, true},
+		{"1000_s", 0, true},
+		{"1.000_000s", 0, true},
+		{"PT1H2M3S", time.Hour + 2*time.Minute + 3*time.Second, false},
+		{"P1Y", 0, true},
+		{"P1M", 0, true},
+		{"P", 0, true},
+		{"PT", 0, true},
+		{"P1DT", 0, true},
+		{"P1H", 0, true},
+		{"PT1M1H", 0, true},
+		{"PT1H1H", 0, true},
+		{"PTH", 0, true},
+		{"P1e308D", 0, true},
+		{"P15000WT100000H", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"d", 0, true},
+		{"1e308d", 0, true},
+		{"-1e308d", 0, true},
+		{"w", 0, true},
+		{"1e308w", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDuration(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDuration(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseDuration(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationParserDefaultUnit(t *testing.T) {
+	tests := []struct {
+		unit    string
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", "5", 5 * time.Second, false},
+		{"ms", "5", 5 * time.Millisecond, false},
+		{"ms", "1.5", 1500 * time.Microsecond, false},
+		{"m", "5", 5 * time.Minute, false},
+		{"d", "2", 48 * time.Hour, false},
+		{"w", "1", 7 * 24 * time.Hour, false},
+		{"ms", "5s", 5 * time.Second, false},
+		{"ms", "2d", 48 * time.Hour, false},
+		{"parsecs", "5", 0, true},
+		{"5s", "5", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.unit+"/"+tt.input, func(t *testing.T) {
+			got, err := DurationParser{DefaultUnit: tt.unit}.Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationParserStrictUnits(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"10s", 10 * time.Second, false},
+		{"1.5h", 90 * time.Minute, false},
+		{"2d", 48 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"PT1M", time.Minute, false},
+		{"0", 0, false},
+		{"1m+30s", 90 * time.Second, false},
+		{"3*10s", 30 * time.Second, false},
+		{"0+1s", time.Second, false},
+		{"1s+0", time.Second, false},
+		{"10", 0, true},
+		{"1.5", 0, true},
+		{"1,000", 0, true},
+		{"10s+5", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := DurationParser{StrictUnits: true}.Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationParserDecimalComma(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"1,5s", 1500 * time.Millisecond, false},
+		{"0,25m", 15 * time.Second, false},
+		{"1,5d", 36 * time.Hour, false},
+		{"2,5", 2500 * time.Millisecond, false},
+		{"1,5m+30s", 2 * time.Minute, false},
+		{"1.5s", 1500 * time.Millisecond, false},
+		{"1_000ms", time.Second, false},
+		{"1,000ms", time.Millisecond, false},
+		{"1,5,5s", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := DurationParser{DecimalComma: true}.Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseDuration("1,5s"); err == nil {
+		t.Error(`ParseDuration("1,5s") succeeded without DecimalComma`)
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{"25%", 0.25, false},
+		{"0%", 0.0, false},
+		{"100%", 1.0, false},
+		{"50%", 0.5, false},
+		{"12.5%", 0.125, false},
+		{"50", 0, true},
+		{"-10%", 0, true},
+		{"abc%", 0, true},
+		{"%", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePercent(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePercent(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParsePercent(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRatio(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    float64
+		wantErr bool
+	}{
+		{"0.2", 0.2, false},
+		{"20%", 0.2, false},
+		{"0", 0, false},
+		{"1.5", 1.5, false},
+		{"abc", 0, true},
+		{"-0.2", 0, true},
+		{"-20%", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRatio(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseRatio(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseRatio(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJitter(t *testing.T) {
+	tests := []struct {
+		input    string
+		wantDown float64
+		wantUp   float64
+		wantErr  bool
+	}{
+		{"20%", 0.2, 0.2, false},
+		{"+50%", 0, 0.5, false},
+		{"-10%", 0.1, 0, false},
+		{"-10%+50%", 0.1, 0.5, false},
+		{"+50%-10%", 0.1, 0.5, false},
+		{"-100%+0%", 1, 0, false},
+		{"150%", 1.5, 1.5, false},
+		{"0.2", 0.2, 0.2, false},
+		{"abc", 0, 0, true},
+		{"10%20%", 0, 0, true},
+		{"-10%-20%", 0, 0, true},
+		{"+10%+20%", 0, 0, true},
+		{"-150%", 0, 0, true},
+		{"+-10%", 0, 0, true},
+		{"+10", 0, 0, true},
+		{"-10%x", 0, 0, true},
+		{"+", 0, 0, true},
+		{"", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			down, up, err := ParseJitter(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseJitter(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (down != tt.wantDown || up != tt.wantUp) {
+				t.Errorf("ParseJitter(%q) = (%v, %v), want (%v, %v)", tt.input, down, up, tt.wantDown, tt.wantUp)
+			}
+		})
+	}
+}
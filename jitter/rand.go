@@ -0,0 +1,171 @@
+package jitter
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	randv2 "math/rand/v2"
+	"sync/atomic"
+)
+
+// ErrRandomness is wrapped by every error that comes from failing to draw
+// random numbers, as opposed to invalid input.
+var ErrRandomness = errors.New("random number generation failed")
+
+// Source supplies the randomness behind sampling.
+type Source interface {
+	// Uint64n returns a uniformly distributed value in [0, n), or in the
+	// full uint64 range if n is 0.
+	Uint64n(n uint64) (uint64, error)
+}
+
+// DefaultRetries is how many draws a Source makes by default before giving
+// up on finding one without modulo bias.
+const DefaultRetries = 1000
+
+// CryptoSource draws from crypto/rand. It is the default Source.
+type CryptoSource struct {
+	// Retries caps the draws made for each value; 0 means DefaultRetries.
+	Retries int
+	// Reader, if set, is read in place of crypto/rand, as a fixed supply
+	// of entropy for reproducible tests. Running out of it is an error.
+	Reader io.Reader
+	// Attempts, if set, is incremented for every 8-byte read, including
+	// those rejected to avoid modulo bias.
+	Attempts *uint64
+}
+
+func (s CryptoSource) Uint64n(n uint64) (uint64, error) {
+	retries := s.Retries
+	if retries <= 0 {
+		retries = DefaultRetries
+	}
+	r := s.Reader
+	if r == nil {
+		r = rand.Reader
+	}
+	return cryptoRandUint64(r, n, retries, s.Attempts)
+}
+
+// SeededSource is a deterministic math/rand generator for reproducible runs.
+// It is not cryptographically secure.
+type SeededSource struct {
+	r *mathrand.Rand
+	// Attempts, if set, is incremented for every raw draw from the
+	// generator, including those rejected to avoid modulo bias.
+	Attempts *uint64
+}
+
+// NewSeededSource returns a SeededSource that always produces the same
+// sequence for the same seed.
+func NewSeededSource(seed uint64) *SeededSource {
+	return &SeededSource{r: mathrand.New(mathrand.NewSource(int64(seed)))}
+}
+
+func (s *SeededSource) Uint64n(n uint64) (uint64, error) {
+	// Whatever fits in an int63 goes through Int63n, as it always has, so
+	// a --seed keeps giving the same durations it did before Uint64n.
+	if n > 0 && n <= math.MaxInt64 {
+		return uint64(s.int63n(int64(n))), nil
+	}
+	return uniformUint64(n, DefaultRetries, s.Attempts, func() (uint64, error) {
+		return s.r.Uint64(), nil
+	})
+}
+
+// int63n is math/rand's Int63n, written out so Attempts can count the draws
+// it rejects. It must keep returning exactly what Int63n would.
+func (s *SeededSource) int63n(n int64) int64 {
+	countAttempt(s.Attempts)
+	if n&(n-1) == 0 {
+		return s.r.Int63() & (n - 1)
+	}
+	limit := int64((1 << 63) - 1 - (1<<63)%uint64(n))
+	v := s.r.Int63()
+	for v > limit {
+		countAttempt(s.Attempts)
+		v = s.r.Int63()
+	}
+	return v % n
+}
+
+// PCGSource is a deterministic, fast PCG generator from math/rand/v2. Like
+// SeededSource it is not cryptographically secure.
+type PCGSource struct {
+	r *randv2.PCG
+	// Attempts, if set, is incremented for every raw draw from the
+	// generator, including those rejected to avoid modulo bias.
+	Attempts *uint64
+}
+
+// NewPCGSource returns a PCGSource that always produces the same sequence
+// for the same seed.
+func NewPCGSource(seed uint64) *PCGSource {
+	return &PCGSource{r: randv2.NewPCG(seed, seed)}
+}
+
+func (s *PCGSource) Uint64n(n uint64) (uint64, error) {
+	return uniformUint64(n, DefaultRetries, s.Attempts, func() (uint64, error) {
+		return s.r.Uint64(), nil
+	})
+}
+
+// cryptoRandUint64 draws a value in [0, n) from r, making at most retries
+// reads of 8 bytes and counting each in attempts if it is set.
+func cryptoRandUint64(r io.Reader, n uint64, retries int, attempts *uint64) (uint64, error) {
+	var buf [8]byte
+	return uniformUint64(n, retries, attempts, func() (uint64, error) {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return 0, err
+		}
+		return binary.LittleEndian.Uint64(buf[:]), nil
+	})
+}
+
+// uniformUint64 maps raw 64-bit draws from next onto [0, n) without modulo
+// bias, rejecting draws that fall in the incomplete final block and giving up
+// after retries of them. n == 0 means the full uint64 range. Every call to
+// next is counted in attempts, if it is set.
+func uniformUint64(n uint64, retries int, attempts *uint64, next func() (uint64, error)) (uint64, error) {
+	if n == 0 {
+		countAttempt(attempts)
+		return next()
+	}
+
+	maxUint := ^uint64(0)
+	limit := maxUint - (maxUint % n)
+
+	for range retries {
+		countAttempt(attempts)
+		v, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if v < limit {
+			return v % n, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: no unbiased value after %d attempts", ErrRandomness, retries)
+}
+
+// countAttempt adds one to attempts, unless it is nil. Sources may be shared
+// across goroutines, so the add is atomic.
+func countAttempt(attempts *uint64) {
+	if attempts != nil {
+		atomic.AddUint64(attempts, 1)
+	}
+}
+
+// draw calls src.Uint64n, marking any failure as ErrRandomness.
+func draw(src Source, n uint64) (uint64, error) {
+	v, err := src.Uint64n(n)
+	if err != nil && !errors.Is(err, ErrRandomness) {
+		return 0, fmt.Errorf("%w: %w", ErrRandomness, err)
+	}
+	return v, err
+}
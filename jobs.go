@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thomasdesr/jsleep/jitter"
+)
+
+// lockedSource makes a Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src jitter.Source
+}
+
+func (l *lockedSource) Uint64n(n uint64) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.src.Uint64n(n)
+}
+
+// runJobs runs opts.jobs sleeps at once, each with its own draw, and waits
+// for all of them. It returns the duration each job chose. An interrupt cuts
+// every job short.
+func runJobs(opts options, interrupt <-chan os.Signal, stderr io.Writer) ([]time.Duration, error) {
+	// Closing stop wakes every job, where a signal would only wake one.
+	stop, done := make(chan os.Signal), make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupt:
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	// crypto/rand is safe to share; the seeded generators and an
+	// --entropy-file's reader are not.
+	if src, ok := opts.rand.(jitter.CryptoSource); !ok || src.Reader != nil {
+		locked := &lockedSource{src: opts.rand}
+		opts.rand, opts.sampling.Source = locked, locked
+	}
+
+	// Every job draws at once, but none sleeps until all have drawn, so
+	// --strict can still refuse the whole run up front.
+	chosen := make([]time.Duration, opts.jobs)
+	errs := make([]error, opts.jobs)
+	var drawn sync.WaitGroup
+	drawn.Add(opts.jobs)
+	start := make(chan struct{})
+	var refused bool
+	var out sync.Mutex
+	var wg sync.WaitGroup
+	for j := range opts.jobs {
+		wg.Go(func() {
+			samples, err := drawSamples(opts, 1)
+			if err != nil {
+				errs[j] = err
+			} else {
+				chosen[j] = samples[0]
+			}
+			drawn.Done()
+			if <-start; refused {
+				return
+			}
+			if opts.verbose > 0 || opts.dryRun {
+				out.Lock()
+				fmt.Fprintf(stderr, "job %d: sleeping for %s\n", j+1, verboseDuration(opts, chosen[j]))
+				out.Unlock()
+			}
+			if !opts.dryRun && !sleep(chosen[j], sleepWall(now(), opts), stop, nil) {
+				errs[j] = errInterrupted
+			}
+		})
+	}
+
+	drawn.Wait()
+	var err error
+	for j, d := range chosen {
+		if err = errs[j]; err != nil {
+			break
+		}
+		if opts.warnAbove > 0 && d > opts.warnAbove {
+			msg := fmt.Sprintf("job %d: chosen sleep %s is above --warn-above %s (interval [%s, %s])", j+1, d, opts.warnAbove, opts.low, opts.high)
+			if opts.strict {
+				err = errors.New(msg)
+				break
+			}
+			fmt.Fprintf(stderr, "jsleep: warning: %s\n", msg)
+		}
+	}
+	refused = err != nil
+	close(start)
+	wg.Wait()
+	if refused {
+		return chosen, err
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return chosen, err
+		}
+	}
+	return chosen, nil
+}
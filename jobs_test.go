@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunJobs(t *testing.T) {
+	for _, seed := range []string{"", "7"} {
+		t.Run("seed="+seed, func(t *testing.T) {
+			args := []string{"--jobs", "8", "-v", "20ms"}
+			if seed != "" {
+				args = append([]string{"--seed", seed}, args...)
+			}
+			opts, err := parseArgs(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stderr bytes.Buffer
+			start := time.Now()
+			chosen, err := runJobs(opts, nil, &stderr)
+			if err != nil {
+				t.Fatalf("runJobs: %v", err)
+			}
+			elapsed := time.Since(start)
+
+			distinct := make(map[time.Duration]bool)
+			var longest time.Duration
+			for i, d := range chosen {
+				if d < opts.low || d > opts.high {
+					t.Errorf("job %d chose %v, want in [%v, %v]", i+1, d, opts.low, opts.high)
+				}
+				distinct[d] = true
+				longest = max(longest, d)
+			}
+			if len(distinct) < 2 {
+				t.Errorf("all jobs chose the same duration: %v", chosen)
+			}
+			if elapsed < longest {
+				t.Errorf("runJobs returned after %v, before the longest job's %v", elapsed, longest)
+			}
+			for j := 1; j <= 8; j++ {
+				if !strings.Contains(stderr.String(), fmt.Sprintf("job %d: sleeping for ", j)) {
+					t.Errorf("no verbose line for job %d:\n%s", j, stderr.String())
+				}
+			}
+		})
+	}
+
+	t.Run("entropy file", func(t *testing.T) {
+		// One 8-byte draw per job, each an offset into [0s, 1s]; the jobs
+		// share the reader, so each draw has to be whole. Run with -race,
+		// this and the seeded runs above catch a source left unlocked.
+		var entropy []byte
+		want := make(map[time.Duration]bool)
+		for j := range 16 {
+			d := time.Duration(j+1) * time.Millisecond
+			entropy = binary.LittleEndian.AppendUint64(entropy, uint64(d))
+			want[d] = true
+		}
+		path := filepath.Join(t.TempDir(), "entropy")
+		if err := os.WriteFile(path, entropy, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		opts, err := parseArgs([]string{"--jobs", "16", "-n", "--entropy-file", path, "--min", "0s", "--max", "1s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		chosen, err := runJobs(opts, nil, new(bytes.Buffer))
+		if err != nil {
+			t.Fatalf("runJobs: %v", err)
+		}
+		for _, d := range chosen {
+			if !want[d] {
+				t.Errorf("a job chose %v, which isn't one of the file's draws", d)
+			}
+			delete(want, d)
+		}
+	})
+
+	t.Run("warn above", func(t *testing.T) {
+		for _, strict := range []bool{false, true} {
+			args := []string{"--jobs", "3", "-n", "--min", "2s", "--max", "3s", "--warn-above", "1s"}
+			if strict {
+				args = append(args, "--strict")
+			}
+			opts, err := parseArgs(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stderr bytes.Buffer
+			_, err = runJobs(opts, nil, &stderr)
+			if strict {
+				if err == nil || !strings.Contains(err.Error(), "above --warn-above") {
+					t.Errorf("--strict: runJobs = %v, want a --warn-above error", err)
+				}
+				if strings.Contains(stderr.String(), "sleeping for") {
+					t.Errorf("--strict: jobs went ahead anyway:\n%s", stderr.String())
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("runJobs: %v", err)
+			}
+			if n := strings.Count(stderr.String(), "above --warn-above"); n != 3 {
+				t.Errorf("got %d --warn-above warnings, want one per job:\n%s", n, stderr.String())
+			}
+		}
+	})
+
+	t.Run("interrupted", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--jobs", "4", "1h"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		interrupt := make(chan os.Signal, 1)
+		interrupt <- os.Interrupt
+		if _, err := runJobs(opts, interrupt, &bytes.Buffer{}); err != errInterrupted {
+			t.Errorf("runJobs error = %v, want errInterrupted", err)
+		}
+	})
+
+	for _, args := range [][]string{
+		{"--jobs", "0", "10s"},
+		{"--jobs", "2", "--count", "3", "10s"},
+		{"--jobs", "2", "--count", "1", "10s"},
+		{"--jobs", "2", "--json", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
@@ -1,278 +1,1420 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
 	"math"
+	"net"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
-	"unicode"
+
+	"github.com/thomasdesr/jsleep/jitter"
 )
 
-const defaultJitterFraction = 0.5
+// options is the resolved result of parsing the command line.
+type options struct {
+	low, high time.Duration
+	dist      string
+	rand      jitter.Source
+	verbose   int // how many times -v was given; see writeDetail
+	quiet     bool
+	color     string // "auto", "always", or "never"
+	json      bool
+	dryRun    bool
+	countdown bool
+	spin      bool
+	count     int           // iterations to run; 0 means forever
+	jobs      int           // concurrent sleeps, each drawing its own duration
+	stats     int           // if positive, summarize this many samples instead of sleeping
+	hist      int           // if positive, draw a histogram of this many samples instead of sleeping
+	maxTotal  time.Duration // if positive, cap on the total time slept across iterations
+	warnAbove time.Duration // if positive, warn about (or with strict, refuse) longer sleeps
+	strict    bool          // with warnAbove, fail instead of warning
+	command   []string      // argv to exec after sleeping, if any
+	deadline  time.Time     // if set, no sleep runs past this time
+	preExec   string        // shell command to run before each sleep
+	postExec  string        // shell command to run after each sleep
+	logFile   string        // if set, each chosen duration is appended here
+
+	// pidWait, if positive, is a process to wait for along with each sleep,
+	// returning at the later or earlier of the two as pidMode says.
+	pidWait int
+	pidMode string
+
+	// explain implies dryRun and prints the resolved path and argv of the
+	// command instead of running it.
+	explain bool
+
+	// ciVar names the --ci-env variable that made --skip-if-ci apply. It
+	// implies dryRun, except that the command still runs.
+	ciVar string
+
+	// align, if positive, extends each sleep so it ends on the next multiple
+	// of align since the Unix epoch.
+	align time.Duration
+
+	// minSleep is a last floor under each chosen duration, applied after
+	// clamping, rounding, and alignment.
+	minSleep time.Duration
+
+	// monotonic measures every sleep on the monotonic clock alone, instead of
+	// catching up to the wall clock when continued after being stopped.
+	monotonic bool
+
+	// reportOnSignal writes what was chosen and how much of it was slept to
+	// stdout as JSON when a signal interrupts a sleep.
+	reportOnSignal bool
+
+	// outputFD, if positive, is an already-open file descriptor that verbose
+	// and countdown output go to instead of stderr.
+	outputFD int
+
+	// syslog sends the verbose line for every sleep to the local syslog
+	// daemon at INFO priority under syslogTag, whether or not -v is given.
+	syslog    bool
+	syslogTag string
+
+	// format, if set, replaces the verbose "sleeping for" line.
+	format *template.Template
+
+	// exitBucket, if positive, splits each interval into this many equal
+	// buckets and makes the exit status exitBucketBase plus the 1-based
+	// bucket of the last chosen duration.
+	exitBucket int
+
+	// at, if set, is the fraction of the way through the distribution every
+	// sleep is taken at, instead of drawing at random.
+	at *float64
+
+	// dumpArgs prints the resolved options instead of sleeping. jitterFrom
+	// says which option the interval came from and rngName names rand, for
+	// it.
+	dumpArgs   bool
+	jitterFrom string
+	rngName    string
+
+	// probability is the chance, from 0 to 1, that each sleep actually
+	// happens rather than being skipped.
+	probability float64
+
+	// metricsFile, if set, is replaced with Prometheus gauges after every
+	// sleep.
+	metricsFile string
+
+	// interactive shows a countdown that keys pause, resume, and skip when
+	// stdin and stderr are terminals. keys delivers those keys once run has
+	// set the terminal up for them.
+	interactive bool
+	keys        <-chan byte
+
+	// durationFormat is the formatDuration style for durations in verbose,
+	// --json, and --stats output. Empty keeps each one's usual form, which
+	// for verbose output is rounded to the millisecond.
+	durationFormat string
+
+	// untilFile, if set, repeats the sleep until the file exists, checking
+	// before each one.
+	untilFile string
+
+	// waitTCP, if set, repeats the sleep until host:port accepts a TCP
+	// connection, trying after each one.
+	waitTCP string
+
+	// baseFile, if set, is read for a new base before every sleep after the
+	// first, by resolving the command line in baseArgs again, so that
+	// everything relative to the base follows it. skipBaseErrors keeps the
+	// last base instead of failing when that doesn't work.
+	baseFile       string
+	baseArgs       []string
+	skipBaseErrors bool
+
+	// drain reads and discards stdin while sleeping, so upstream writers in
+	// a pipeline don't block.
+	drain bool
+
+	// stateFile, if set, holds the wake time of the sleep in progress, so
+	// a run restarted partway through sleeps only what is left.
+	stateFile string
+
+	// base is the duration the interval was built around, or its midpoint
+	// when only --min and --max were given. With backoff, each iteration
+	// rebuilds the interval from base scaled by backoffFactor per step,
+	// using the same sampling options.
+	base          time.Duration
+	backoff       bool
+	backoffFactor float64
+	sampling      jitter.Options
+
+	// empirical, if non-empty, holds the --dist-file or --choices durations,
+	// one of which is picked at random as the base for every sleep. low and
+	// high then span the intervals around all of them.
+	empirical []time.Duration
+
+	ignoreSignals bool
+
+	// roundMode is "round", "floor", "ceil", or "quantize" when each chosen
+	// duration is rounded to a multiple of roundUnit, and empty otherwise.
+	roundMode string
+	roundUnit time.Duration
+
+	// unclampedLow and unclampedHigh are the interval before --min, --max,
+	// and the zero floor were applied, for --clamp-report.
+	unclampedLow, unclampedHigh time.Duration
+	clampReport                 bool
+
+	// warnings are printed to stderr in verbose mode before the first sleep.
+	warnings []string
+}
+
+// now is the clock behind --until, log timestamps, and measured sleep times,
+// swapped out in tests.
+var now = time.Now
+
+// stdin is read when the base duration is given as "-".
+var stdin io.Reader = os.Stdin
+
+// errInterrupted reports that the sleep was cut short by a signal.
+var errInterrupted = errors.New("interrupted")
 
 func main() {
-	low, high, verbose, err := parseArgs(os.Args[1:])
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "jsleep: %v\n", err)
-		os.Exit(1)
-	}
+	os.Exit(runMain(os.Args[1:], os.Stdout, os.Stderr))
+}
 
-	sleepValue, err := chooseSleepDuration(low, high)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "jsleep: %v\n", err)
-		os.Exit(1)
-	}
+// Exit statuses, so scripts can tell failures apart.
+const (
+	exitOK            = 0
+	exitFailure       = 1 // anything not covered below
+	exitUsage         = 2
+	exitRandomness    = 3
+	exitEmptyInterval = 4
+	exitInterrupted   = 130
+
+	// --exit-bucket's bucket b exits with exitBucketBase+b rather than b,
+	// so bucket 2 can't be mistaken for exitUsage and so on, and stays
+	// below the 126 and up that shells reserve.
+	exitBucketBase = 10
+	maxExitBuckets = 125 - exitBucketBase
+)
 
-	if verbose {
-		fmt.Fprintf(os.Stderr, "sleeping for %s\n", sleepValue.Round(time.Millisecond))
+// runMain runs jsleep, reports any error on stderr, and returns the exit
+// status.
+func runMain(args []string, stdout, stderr io.Writer) int {
+	err := run(args, stdout, stderr)
+	code := exitCode(err)
+	var bucket bucketExit
+	if code != exitOK && code != exitInterrupted && !errors.As(err, &bucket) {
+		fmt.Fprintf(stderr, "jsleep: %v\n", err)
 	}
+	return code
+}
 
-	time.Sleep(sleepValue)
+// exitCode maps an error from run to an exit status. A bucketExit is offset
+// by exitBucketBase so that it never collides with the failure statuses.
+func exitCode(err error) int {
+	var usage usageError
+	var bucket bucketExit
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &bucket):
+		return exitBucketBase + int(bucket)
+	case errors.Is(err, errInterrupted):
+		return exitInterrupted
+	case errors.Is(err, jitter.ErrEmptyInterval):
+		return exitEmptyInterval
+	case errors.Is(err, jitter.ErrRandomness):
+		return exitRandomness
+	case errors.As(err, &usage):
+		return exitUsage
+	default:
+		return exitFailure
+	}
 }
 
-func usage() {
-	fmt.Fprint(os.Stderr, `jsleep - jittered sleep
+// usageError marks an error in the command line itself.
+type usageError struct {
+	err error
+}
 
-Usage:
-  jsleep <duration>                    Default 50% jitter
-  jsleep <duration> <percent>          Positional percent jitter (e.g., 25%)
-  jsleep <duration> --jitter <percent> Explicit percent jitter
-  jsleep <duration> --range <duration> Absolute jitter range (±duration)
-  jsleep --min <duration> --max <duration>
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
 
-Options:
-  -j, --jitter <percent>   Jitter as percent (e.g., 20%); defaults to 50%.
-  -r, --range <duration>   Absolute jitter range (e.g., 2s for +/- 2 seconds).
+// bucketExit is returned by run to exit with the --exit-bucket the chosen
+// duration fell in. It is a result rather than a failure, so runMain doesn't
+// report it.
+type bucketExit int
 
-  -m, --min <duration>     Clamp jitter result to this minimum (e.g., jsleep --min 9s 10s).
-  -M, --max <duration>     Clamp jitter result to this maximum.
+func (b bucketExit) Error() string { return fmt.Sprintf("chosen duration is in bucket %d", int(b)) }
 
-  -v, --verbose            Print the chosen sleep duration to stderr.
-  -h, --help               Show this help.
-`)
-}
+// run is the body of main with its I/O made explicit for testing.
+func run(args []string, stdout, stderr io.Writer) error {
+	// Anything other than a known subcommand is the usual command line.
+	if len(args) > 0 {
+		switch args[0] {
+		case "sample":
+			return runSample(args[1:], stdout)
+		case "stream":
+			return runStream(args[1:], stdout)
+		case "cron":
+			return runCron(args[1:], stdout, stderr)
+		case "completion":
+			return runCompletion(args[1:], stdout)
+		case "bench-rng":
+			return runBenchRNG(args[1:], stdout)
+		}
+	}
 
-func parseArgs(args []string) (low, high time.Duration, verbose bool, err error) {
-	fs := flag.NewFlagSet("jsleep", flag.ContinueOnError)
-	fs.SetOutput(os.Stderr)
-	fs.Usage = usage
+	opts, err := parseArgs(args)
+	if err != nil {
+		return usageError{err}
+	}
+	if opts.dumpArgs {
+		writeDump(stdout, opts)
+		return nil
+	}
 
-	var jitterStr, rangeStr, minStr, maxStr string
-	fs.StringVar(&jitterStr, "jitter", "", "percent jitter (e.g., 20%)")
-	fs.StringVar(&jitterStr, "j", "", "percent jitter (e.g., 20%)")
-	fs.StringVar(&rangeStr, "range", "", "absolute jitter range (e.g., 2s for ±2 seconds)")
-	fs.StringVar(&rangeStr, "r", "", "absolute jitter range (e.g., 2s for ±2 seconds)")
-	fs.StringVar(&minStr, "min", "", "minimum duration bound")
-	fs.StringVar(&minStr, "m", "", "minimum duration bound")
-	fs.StringVar(&maxStr, "max", "", "maximum duration bound")
-	fs.StringVar(&maxStr, "M", "", "maximum duration bound")
-	fs.BoolVar(&verbose, "verbose", false, "verbose output")
-	fs.BoolVar(&verbose, "v", false, "verbose output")
+	// --output-fd takes stderr's place for everything but errors.
+	countdownFile := os.Stderr
+	if opts.outputFD > 0 {
+		f, err := openOutputFD(opts.outputFD)
+		if err != nil {
+			return fmt.Errorf("--output-fd: %w", err)
+		}
+		if f != os.Stdout && f != os.Stderr {
+			defer f.Close()
+		}
+		stderr, countdownFile = f, f
+	}
 
-	if err = fs.Parse(args); err != nil {
-		return
+	// Quiet beats every other output option; only errors get through.
+	if opts.quiet {
+		stdout, stderr = io.Discard, io.Discard
+		opts.countdown, opts.interactive = false, false
 	}
 
-	pos := fs.Args()
-	if len(pos) > 2 {
-		err = errors.New("too many positional arguments")
-		return
+	// Resolve the command up front so a typo fails fast instead of after
+	// the sleep.
+	var commandPath string
+	if len(opts.command) > 0 && (!opts.dryRun || opts.explain || opts.ciVar != "") {
+		if commandPath, err = exec.LookPath(opts.command[0]); err != nil {
+			return err
+		}
 	}
 
-	var positionalJitter string
-	if len(pos) == 2 {
-		positionalJitter = pos[1]
+	// A nil channel never fires, leaving the default die-on-signal behavior.
+	var interrupt chan os.Signal
+	if !opts.ignoreSignals && !opts.dryRun {
+		interrupt = make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
 	}
 
-	jitterSet := jitterStr != ""
-	rangeSet := rangeStr != ""
-	minSet := minStr != ""
-	maxSet := maxStr != ""
+	// --interactive needs the terminal back as it was however jsleep ends,
+	// so SIGTERM is caught too rather than left to kill it.
+	restoreTerminal := func() {}
+	if opts.interactive && interrupt != nil && isTerminal(os.Stdin) && isTerminal(countdownFile) {
+		if restoreTerminal, err = rawTerminal(os.Stdin); err != nil {
+			return fmt.Errorf("--interactive: %w", err)
+		}
+		defer restoreTerminal()
+		signal.Notify(interrupt, syscall.SIGTERM)
+		opts.keys = readKeys(os.Stdin)
+	}
 
-	if jitterSet && rangeSet {
-		err = errors.New("cannot use --jitter with --range")
-		return
+	stopDrain := func() {}
+	if opts.drain && !opts.dryRun {
+		stopDrain = drain(stdin)
+		defer stopDrain()
 	}
-	if positionalJitter != "" && jitterSet {
-		err = errors.New("cannot specify jitter both positionally and with --jitter")
-		return
+
+	if opts.clampReport && (opts.low != opts.unclampedLow || opts.high != opts.unclampedHigh) {
+		fmt.Fprintf(stderr, "jsleep: clamped [%s, %s] to [%s, %s]\n", opts.unclampedLow, opts.unclampedHigh, opts.low, opts.high)
 	}
-	if positionalJitter != "" && rangeSet {
-		err = errors.New("cannot use positional jitter with --range")
-		return
+
+	if opts.stats > 0 {
+		samples, err := drawSamples(opts, opts.stats)
+		if err != nil {
+			return err
+		}
+		writeStats(stdout, samples, opts.durationFormat)
+		return nil
 	}
 
-	var rangeVal, minVal, maxVal time.Duration
-	if rangeSet {
-		if rangeVal, err = parseDuration(rangeStr); err != nil {
-			return
+	if opts.hist > 0 {
+		samples, err := drawSamples(opts, opts.hist)
+		if err != nil {
+			return err
 		}
+		writeHistogram(stdout, histogram(samples, opts.low, opts.high, histBins), opts.low, opts.high, terminalWidth())
+		return nil
 	}
-	if minSet {
-		if minVal, err = parseDuration(minStr); err != nil {
-			return
+
+	if opts.verbose > 0 || opts.dryRun {
+		for _, w := range opts.warnings {
+			fmt.Fprintf(stderr, "jsleep: warning: %s\n", w)
 		}
 	}
-	if maxSet {
-		if maxVal, err = parseDuration(maxStr); err != nil {
-			return
+
+	if opts.jobs > 1 {
+		if _, err := runJobs(opts, interrupt, stderr); err != nil {
+			return err
 		}
+		if commandPath != "" {
+			return runCommand(stdout, opts, commandPath)
+		}
+		return nil
 	}
-	if minSet && maxSet && maxVal < minVal {
-		err = errors.New("max must be greater than or equal to min")
-		return
+
+	var logFile *os.File
+	if opts.logFile != "" {
+		if logFile, err = os.OpenFile(opts.logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644); err != nil {
+			return err
+		}
+		defer logFile.Close()
 	}
 
-	var base time.Duration
-	var hasBase bool
-	if len(pos) == 1 || len(pos) == 2 {
-		if base, err = parseDuration(pos[0]); err != nil {
-			return
+	var sysLog io.WriteCloser
+	if opts.syslog {
+		if sysLog, err = openSyslog(opts.syslogTag); err != nil {
+			return fmt.Errorf("--syslog: %w", err)
 		}
-		hasBase = true
+		defer sysLog.Close()
 	}
 
-	switch {
-	case rangeSet:
-		if !hasBase {
-			err = errors.New("--range requires a base duration")
-			return
-		}
-		low, high = base-rangeVal, base+rangeVal
-
-	case hasBase:
-		fraction := defaultJitterFraction
-		if jitterSet {
-			if fraction, err = parsePercent(jitterStr); err != nil {
-				return
+	colors := palette{enabled: useColor(opts.color, stderr)}
+
+	// --interactive always redraws the time left, with or without
+	// --countdown.
+	var progress io.Writer
+	if (opts.countdown && isTerminal(countdownFile)) || opts.keys != nil {
+		progress = stderr
+	}
+
+	// -vvv reports the values and raw draws behind each sleep, so count
+	// them.
+	var draws *countingSource
+	if opts.verbose >= 3 {
+		draws = newCountingSource(opts.rand)
+		opts.rand, opts.sampling.Source = draws, draws
+	}
+
+	var spent time.Duration
+	var bucket int
+	var found bool
+	for i := 1; opts.count == 0 || i <= opts.count; i++ {
+		if opts.untilFile != "" {
+			var ferr error
+			if found, ferr = fileExists(opts.untilFile); ferr != nil {
+				return ferr
 			}
-		} else if positionalJitter != "" {
-			if fraction, err = parsePercent(positionalJitter); err != nil {
-				return
+			if found {
+				break
 			}
 		}
-		baseNs := float64(base.Nanoseconds())
-		delta := math.Round(baseNs * fraction)
-		if math.IsNaN(delta) || math.IsInf(delta, 0) {
-			err = errors.New("jitter results overflow time.Duration")
-			return
+		// Unlike --until-file, --wait-for-tcp always sleeps at least once.
+		if opts.waitTCP != "" && i > 1 {
+			if found = tcpReachable(opts.waitTCP); found {
+				break
+			}
+		}
+		if draws != nil {
+			draws.reset()
 		}
-		lowNs, highNs := baseNs-delta, baseNs+delta
-		if lowNs < math.MinInt64 || lowNs > math.MaxInt64 || highNs < math.MinInt64 || highNs > math.MaxInt64 {
-			err = errors.New("jitter results overflow time.Duration")
-			return
+		if opts.baseFile != "" && i > 1 {
+			if berr := rereadBase(&opts); berr != nil {
+				if !opts.skipBaseErrors {
+					return berr
+				}
+				if opts.verbose > 0 {
+					fmt.Fprintf(stderr, "jsleep: warning: %s; keeping the base at %s\n", berr, opts.base)
+				}
+			}
+		}
+		low, high, base, err := iterationBounds(opts, i)
+		if err != nil {
+			return err
 		}
-		low, high = time.Duration(lowNs), time.Duration(highNs)
 
-	case minSet && maxSet:
-		low, high = minVal, maxVal
+		sleepValue, err := chooseDuration(opts, low, high, base)
+		if err != nil {
+			return err
+		}
+		if sleepValue, err = applyRounding(opts, sleepValue, low, high); err != nil {
+			return err
+		}
+		if opts.align > 0 {
+			sleepValue = alignDuration(sleepValue, opts.align, now())
+		}
+		sleepValue = max(sleepValue, opts.minSleep)
+		if opts.stateFile != "" && !opts.dryRun {
+			if sleepValue, err = resumeState(opts.stateFile, sleepValue, now()); err != nil {
+				return err
+			}
+		}
+		if opts.exitBucket > 0 {
+			bucket = bucketOf(sleepValue, low, high, opts.exitBucket)
+		}
+		if opts.warnAbove > 0 && sleepValue > opts.warnAbove {
+			msg := fmt.Sprintf("chosen sleep %s is above --warn-above %s (interval [%s, %s])", sleepValue, opts.warnAbove, low, high)
+			if opts.strict {
+				return errors.New(msg)
+			}
+			fmt.Fprintf(stderr, "jsleep: warning: %s\n", msg)
+		}
 
-	default:
-		err = errors.New("missing required duration")
-		return
+		// Once a draw would use up the rest of the budget, sleep only what
+		// is left and stop. --json still reports the draw itself, which
+		// stays inside the interval, and the cut-down sleep beside it.
+		drawn := sleepValue
+		var last bool
+		if opts.maxTotal > 0 && sleepValue >= opts.maxTotal-spent {
+			sleepValue, last = opts.maxTotal-spent, true
+		}
+		// Likewise a deadline wins over the interval, even its low end.
+		if !opts.deadline.IsZero() {
+			if left := max(opts.deadline.Sub(now()), 0); sleepValue >= left {
+				sleepValue, last = left, true
+			}
+		}
+
+		if opts.verbose > 0 || opts.dryRun {
+			if err := writeVerbose(stderr, opts, colors, i, low, high, sleepValue); err != nil {
+				return err
+			}
+		}
+		if opts.verbose >= 2 {
+			writeDetail(stderr, opts, low, high, draws)
+		}
+		if sysLog != nil {
+			var line strings.Builder
+			if err := writeVerbose(&line, opts, palette{}, i, low, high, sleepValue); err != nil {
+				return err
+			}
+			if _, err := io.WriteString(sysLog, line.String()); err != nil {
+				return err
+			}
+		}
+		if opts.json {
+			if err := writeJSON(stdout, low, high, drawn, sleepValue, opts.durationFormat); err != nil {
+				return err
+			}
+		}
+		if logFile != nil {
+			if _, err := fmt.Fprintf(logFile, "%s chosen=%s range=[%s,%s]\n", now().Format(time.RFC3339), sleepValue, low, high); err != nil {
+				return err
+			}
+		}
+
+		slept := false
+		if !opts.dryRun {
+			if slept, err = jitter.Chance(opts.probability, opts.rand); err != nil {
+				return err
+			}
+		}
+		if slept {
+			if opts.preExec != "" {
+				if err := runHook("pre-exec", opts.preExec); err != nil {
+					return err
+				}
+			}
+			elapsed, ok := runSleep(sleepValue, opts, interrupt, progress)
+			if !ok {
+				if opts.reportOnSignal {
+					if err := writeInterruptJSON(stdout, sleepValue, elapsed); err != nil {
+						return err
+					}
+				}
+				return errInterrupted
+			}
+			if opts.postExec != "" {
+				if err := runHook("post-exec", opts.postExec); err != nil {
+					return err
+				}
+			}
+			if opts.verbose > 0 {
+				fmt.Fprintf(stderr, "chosen=%s actual=%s\n", verboseDuration(opts, sleepValue), verboseDuration(opts, elapsed))
+			}
+		} else if !opts.dryRun && opts.verbose > 0 {
+			fmt.Fprintf(stderr, "skipped sleep (--probability %g%%)\n", opts.probability*100)
+		}
+		if opts.stateFile != "" && !opts.dryRun {
+			if err := clearState(opts.stateFile); err != nil {
+				return err
+			}
+		}
+
+		if opts.metricsFile != "" {
+			if err := writeMetrics(opts.metricsFile, low, high, sleepValue); err != nil {
+				return err
+			}
+		}
+
+		if slept || opts.dryRun {
+			spent += sleepValue
+		}
+		if opts.maxTotal > 0 && (opts.verbose > 0 || opts.dryRun) {
+			fmt.Fprintf(stderr, "budget remaining: %s\n", (opts.maxTotal - spent).Round(time.Millisecond))
+		}
+		if last {
+			break
+		}
+	}
+
+	if opts.untilFile != "" && !found {
+		// The last sleep may have been the one that waited long enough.
+		found, err := fileExists(opts.untilFile)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("--until-file: %s did not appear", opts.untilFile)
+		}
 	}
+	if opts.waitTCP != "" && !found && !tcpReachable(opts.waitTCP) {
+		return fmt.Errorf("--wait-for-tcp: %s did not accept a connection", opts.waitTCP)
+	}
+
+	if bucket > 0 {
+		return bucketExit(bucket)
+	}
+	if commandPath != "" {
+		// Exec doesn't return to run the deferred calls, and the command
+		// should get what is left of stdin.
+		restoreTerminal()
+		stopDrain()
+		return runCommand(stdout, opts, commandPath)
+	}
+	return nil
+}
+
+// fileExists reports whether there is a file at path.
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// tcpProbeTimeout bounds each connection attempt --wait-for-tcp makes.
+const tcpProbeTimeout = time.Second
 
-	if minSet {
-		low, high = max(low, minVal), max(high, minVal)
+// tcpReachable reports whether addr accepts a TCP connection within
+// tcpProbeTimeout.
+func tcpReachable(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, tcpProbeTimeout)
+	if err != nil {
+		return false
 	}
-	if maxSet {
-		low, high = min(low, maxVal), min(high, maxVal)
+	conn.Close()
+	return true
+}
+
+// ciVar returns the first of the comma-separated environment variables in
+// names that says we're in CI, or "" if none does. A variable says so if it
+// is set to anything but "", "0", or "false", as CI=false turns CI off.
+func ciVar(names string) string {
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.TrimSpace(name)
+		switch v, _ := os.LookupEnv(name); strings.ToLower(v) {
+		case "", "0", "false":
+		default:
+			return name
+		}
 	}
-	low, high = max(low, 0), max(high, 0)
+	return ""
+}
 
-	if high < low {
-		err = errors.New("defined interval is empty after clamping")
-		return
+// runCommand execs the command after the sleeps, or under --explain prints
+// its absolute path and quoted argv to w as key=value lines instead.
+func runCommand(w io.Writer, opts options, path string) error {
+	if !opts.explain {
+		return execCommand(path, opts.command)
 	}
-	return
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	argv := make([]string, len(opts.command))
+	for i, arg := range opts.command {
+		argv[i] = strconv.Quote(arg)
+	}
+	fmt.Fprintf(w, "path=%s\nargv=%s\n", abs, strings.Join(argv, " "))
+	return nil
 }
 
-func parseDuration(s string) (time.Duration, error) {
-	if s == "" {
-		return 0, errors.New("empty duration")
+// bucketOf returns which of n equal buckets spanning [low, high] d is in,
+// counting from 1. high itself is in the last bucket.
+func bucketOf(d, low, high time.Duration, n int) int {
+	if high <= low {
+		return 1
+	}
+	b := int(float64(d-low)/float64(high-low)*float64(n)) + 1
+	return min(max(b, 1), n)
+}
+
+// envSeed hashes a --seed-env value into a seed with 64-bit FNV-1a, so the
+// same value always seeds the same sequence.
+func envSeed(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	return h.Sum64()
+}
+
+// entropyReader reads the bytes of an --entropy-file, naming the file once
+// they run out.
+type entropyReader struct {
+	name string
+	r    io.Reader
+}
+
+func (e *entropyReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		err = fmt.Errorf("--entropy-file %s ran out of bytes", e.name)
+	}
+	return n, err
+}
+
+// newSource returns the --rng generator called name. The seed is ignored by
+// crypto.
+func newSource(name string, seed uint64) (jitter.Source, error) {
+	switch name {
+	case "crypto":
+		return jitter.CryptoSource{}, nil
+	case "math":
+		return jitter.NewSeededSource(seed), nil
+	case "pcg":
+		return jitter.NewPCGSource(seed), nil
+	}
+	return nil, fmt.Errorf("unknown rng: %s", name)
+}
+
+// runSample implements "jsleep sample": it takes the usual options plus
+// -n <count> anywhere among them, and prints count sampled durations to
+// stdout, one per line, without sleeping.
+func runSample(args []string, stdout io.Writer) error {
+	count := 1
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		val, ok := strings.CutPrefix(arg, "-n=")
+		if !ok && arg != "-n" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !ok {
+			if i+1 == len(args) {
+				return usageError{errors.New("sample: -n requires a count")}
+			}
+			i++
+			val = args[i]
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			return usageError{fmt.Errorf("sample: invalid count: %s", val)}
+		}
+		count = n
 	}
 
-	// Handle days.
-	if strings.HasSuffix(s, "d") {
-		num, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+	opts, err := parseArgs(rest)
+	if err != nil {
+		return usageError{err}
+	}
+	if len(opts.command) > 0 {
+		return usageError{errors.New("sample: cannot run a command")}
+	}
+	if opts.quiet {
+		stdout = io.Discard
+	}
+
+	samples, err := drawSamples(opts, count)
+	if err != nil {
+		return err
+	}
+	for _, d := range samples {
+		fmt.Fprintln(stdout, formatDuration(d, opts.durationFormat))
+	}
+	return nil
+}
+
+// iterationBounds returns the interval and base for the i-th sleep, counting
+// from 1. They are the parsed ones unless backoff scales the base for each
+// step or --dist-file or --choices supplies a new base at random every time.
+func iterationBounds(opts options, i int) (low, high, base time.Duration, err error) {
+	switch {
+	case opts.backoff:
+		base = backoffBase(opts.base, opts.backoffFactor, i-1, opts.sampling.Max)
+	case len(opts.empirical) > 0:
+		n, rerr := opts.rand.Uint64n(uint64(len(opts.empirical)))
+		if rerr != nil {
+			return 0, 0, 0, fmt.Errorf("%w: %w", jitter.ErrRandomness, rerr)
+		}
+		base = opts.empirical[n]
+	default:
+		return opts.low, opts.high, opts.base, nil
+	}
+	low, high, err = jitter.Bounds(base, opts.sampling)
+	return low, high, base, err
+}
+
+// drawSamples samples n durations from the configured interval without
+// sleeping.
+func drawSamples(opts options, n int) ([]time.Duration, error) {
+	samples := make([]time.Duration, n)
+	for i := range samples {
+		low, high, base, err := iterationBounds(opts, 1)
+		if err != nil {
+			return nil, err
+		}
+		d, err := chooseDuration(opts, low, high, base)
 		if err != nil {
-			return 0, fmt.Errorf("invalid duration: %s", s)
+			return nil, err
+		}
+		if d, err = applyRounding(opts, d, low, high); err != nil {
+			return nil, err
 		}
+		samples[i] = max(d, opts.minSleep)
+	}
+	return samples, nil
+}
 
-		const maxDays = float64(math.MaxInt64) / float64(24*time.Hour)
-		if num > maxDays || num < -maxDays {
-			return 0, fmt.Errorf("duration out of range: %s", s)
+// writeDump prints what parseArgs resolved for --dump-args to w, one
+// key=value pair per line.
+func writeDump(w io.Writer, opts options) {
+	bound := func(d *time.Duration) string {
+		if d == nil {
+			return "none"
 		}
+		return d.String()
+	}
+	fmt.Fprintf(w, "base=%s\n", opts.base)
+	fmt.Fprintf(w, "jitter_source=%s\n", opts.jitterFrom)
+	fmt.Fprintf(w, "jitter_down=%g%%\n", opts.sampling.Down*100)
+	fmt.Fprintf(w, "jitter_up=%g%%\n", opts.sampling.Up*100)
+	fmt.Fprintf(w, "jitter_mode=%s\n", opts.sampling.JitterMode)
+	fmt.Fprintf(w, "range=%s\n", opts.sampling.Range)
+	fmt.Fprintf(w, "offset=%s\n", opts.sampling.Offset)
+	fmt.Fprintf(w, "unclamped_low=%s\n", opts.unclampedLow)
+	fmt.Fprintf(w, "unclamped_high=%s\n", opts.unclampedHigh)
+	fmt.Fprintf(w, "min=%s\n", bound(opts.sampling.Min))
+	fmt.Fprintf(w, "max=%s\n", bound(opts.sampling.Max))
+	fmt.Fprintf(w, "clamp_mode=%s\n", opts.sampling.ClampMode)
+	fmt.Fprintf(w, "low=%s\n", opts.low)
+	fmt.Fprintf(w, "high=%s\n", opts.high)
+	fmt.Fprintf(w, "dist=%s\n", opts.dist)
+	fmt.Fprintf(w, "rng=%s\n", opts.rngName)
+}
+
+// writeStats prints a summary of samples to w, one key=value pair per line.
+func writeStats(w io.Writer, samples []time.Duration, style string) {
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
 
-		return time.Duration(num * float64(24*time.Hour)), nil
+	var sum float64
+	for _, d := range sorted {
+		sum += float64(d)
 	}
+	// The median is p50 under another name, so it is a draw too rather
+	// than the mean of the middle two.
+	n := len(sorted)
+	median := percentile(sorted, 50)
 
-	// Append "s" if the duration is a number without a unit.
-	if unicode.IsDigit(rune(s[len(s)-1])) {
-		s += "s"
+	fmt.Fprintf(w, "count=%d\n", n)
+	fmt.Fprintf(w, "min=%s\n", formatDuration(sorted[0], style))
+	fmt.Fprintf(w, "max=%s\n", formatDuration(sorted[n-1], style))
+	fmt.Fprintf(w, "mean=%s\n", formatDuration(time.Duration(math.Round(sum/float64(n))), style))
+	fmt.Fprintf(w, "median=%s\n", formatDuration(median, style))
+	for _, p := range []int{50, 90, 99} {
+		fmt.Fprintf(w, "p%d=%s\n", p, formatDuration(percentile(sorted, p), style))
 	}
-	return time.ParseDuration(s)
 }
 
-func parsePercent(s string) (float64, error) {
-	if !strings.HasSuffix(s, "%") {
-		return 0, fmt.Errorf("percent must end with %%: %s", s)
+// chooseDuration picks a sleep within [low, high] around base: the --at
+// quantile if one was given, or else a random draw.
+func chooseDuration(opts options, low, high, base time.Duration) (time.Duration, error) {
+	if opts.at != nil {
+		return jitter.Quantile(low, high, base+opts.sampling.Offset, opts.dist, *opts.at)
 	}
-	val, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
-	if err != nil {
-		return 0, fmt.Errorf("invalid percent: %s", s)
+	return jitter.ChooseSleepDurationAround(low, high, base+opts.sampling.Offset, opts.dist, opts.rand)
+}
+
+// applyRounding rounds d as --round, --floor, or --ceil asked, failing if
+// that pushes it past --min or --max, or as --quantize asked within the
+// iteration's [low, high].
+func applyRounding(opts options, d, low, high time.Duration) (time.Duration, error) {
+	switch opts.roundMode {
+	case "":
+		return d, nil
+	case "quantize":
+		r, ok := quantizeDuration(d, opts.roundUnit, low, high)
+		if !ok {
+			return 0, fmt.Errorf("--quantize %s has no multiple in [%s, %s]", opts.roundUnit, low, high)
+		}
+		return r, nil
+	}
+	r := roundDuration(d, opts.roundUnit, opts.roundMode)
+	if (opts.sampling.Min != nil && r < *opts.sampling.Min) || (opts.sampling.Max != nil && r > *opts.sampling.Max) {
+		return 0, fmt.Errorf("--%s %s turns %s into %s, outside --min/--max", opts.roundMode, opts.roundUnit, d, r)
+	}
+	return r, nil
+}
+
+// alignDuration extends d so that a sleep of it starting at t wakes on a
+// multiple of unit since the Unix epoch, saturating instead of overflowing.
+func alignDuration(d, unit time.Duration, t time.Time) time.Duration {
+	r := time.Duration(t.Add(d).UnixNano() % int64(unit))
+	if r < 0 {
+		r += unit
+	}
+	if r == 0 {
+		return d
+	}
+	if d > math.MaxInt64-(unit-r) {
+		return d
 	}
-	if val < 0 {
-		return 0, errors.New("jitter cannot be negative")
+	return d + unit - r
+}
+
+// roundDuration rounds d to a multiple of unit: to the nearest one for
+// "round", down for "floor", and up for "ceil", saturating instead of
+// overflowing.
+func roundDuration(d, unit time.Duration, mode string) time.Duration {
+	switch mode {
+	case "floor":
+		return d.Truncate(unit)
+	case "ceil":
+		t := d.Truncate(unit)
+		if t == d {
+			return d
+		}
+		if t > math.MaxInt64-unit {
+			return t
+		}
+		return t + unit
+	default:
+		return d.Round(unit)
+	}
+}
+
+// quantizeDuration rounds d to the nearest multiple of unit in [low, high],
+// rounding the other way if the nearest is outside. It reports false if no
+// multiple of unit is in the interval.
+func quantizeDuration(d, unit, low, high time.Duration) (time.Duration, bool) {
+	r := roundDuration(d, unit, "round")
+	if r > high {
+		r = roundDuration(d, unit, "floor")
+	}
+	if r < low {
+		r = roundDuration(d, unit, "ceil")
 	}
-	return val / 100, nil
+	return r, r >= low && r <= high
 }
 
-func chooseSleepDuration(low, high time.Duration) (time.Duration, error) {
+// histBins is how many buckets --hist splits the interval into.
+const histBins = 20
+
+// histogram counts samples into bins equal-width buckets spanning [low,
+// high]. A zero-width interval gets a single bucket holding everything.
+func histogram(samples []time.Duration, low, high time.Duration, bins int) []int {
 	if high == low {
-		return max(low, 0), nil
+		return []int{len(samples)}
+	}
+	counts := make([]int, bins)
+	width := float64(high - low)
+	for _, d := range samples {
+		i := int(float64(d-low) / width * float64(bins))
+		counts[min(max(i, 0), bins-1)]++
 	}
+	return counts
+}
 
-	if low > high {
-		return 0, errors.New("low must be less than or equal to high")
+// writeHistogram prints one bar per bucket of counts, labelled with the
+// bucket's lower edge and scaled so the fullest bucket fits in width columns.
+func writeHistogram(w io.Writer, counts []int, low, high time.Duration, width int) {
+	labels := make([]string, len(counts))
+	labelWidth, most := 0, 0
+	for i, c := range counts {
+		edge := low + time.Duration(float64(high-low)*float64(i)/float64(len(counts)))
+		labels[i] = edge.Round(time.Millisecond).String()
+		labelWidth = max(labelWidth, len(labels[i]))
+		most = max(most, c)
 	}
+	countWidth := len(strconv.Itoa(most))
+	barWidth := max(width-labelWidth-countWidth-4, 1)
 
-	width := high - low
-	if low+width == math.MaxInt64 {
-		return high, nil
+	for i, c := range counts {
+		bar := 0
+		if most > 0 {
+			bar = c * barWidth / most
+		}
+		fmt.Fprintf(w, "%*s | %-*s %*d\n", labelWidth, labels[i], barWidth, strings.Repeat("#", bar), countWidth, c)
 	}
+}
 
-	offset, err := cryptoRandInt64(int64(width) + 1)
-	if err != nil {
-		return 0, err
+// terminalWidth returns the width in $COLUMNS, or 80 if it isn't set.
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
 	}
-	return max(low+time.Duration(offset), 0), nil
+	return 80
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
 }
 
-func cryptoRandInt64(n int64) (int64, error) {
-	if n <= 0 {
-		return 0, errors.New("n must be positive")
+// backoffBase returns the base for a zero-based backoff step: base scaled by
+// factor^step, saturating rather than overflowing, and capped at limit if set.
+func backoffBase(base time.Duration, factor float64, step int, limit *time.Duration) time.Duration {
+	d := time.Duration(math.MaxInt64)
+	if ns := float64(base) * math.Pow(factor, float64(step)); ns < math.MaxInt64 {
+		d = time.Duration(ns)
+	}
+	if limit != nil {
+		d = min(d, *limit)
 	}
+	return d
+}
+
+// sleep waits for d, returning false if interrupt fires first. If progress is
+// non-nil, a countdown is redrawn on it every second and cleared at the end.
+//
+// The wait is measured against a monotonic deadline, so setting the wall
+// clock doesn't stretch or cut it short; a timer that fires early is simply
+// reset for what is left. The monotonic clock stops on some systems while
+// the machine is suspended, though, so if wall is non-zero it is taken as
+// the wall-clock start of the sleep, and whenever jsleep is continued after
+// being stopped the deadline moves to what is left by the now clock. A zero
+// wall (--cpu-affinity-safe) keeps to the monotonic clock throughout.
+func sleep(d time.Duration, wall time.Time, interrupt <-chan os.Signal, progress io.Writer) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	var buf [8]byte
-	maxUint := ^uint64(0)
-	limit := maxUint - (maxUint % uint64(n))
+	deadline := time.Now().Add(d)
+	var resumed <-chan os.Signal
+	if !wall.IsZero() {
+		var stop func()
+		resumed, stop = notifyContinue()
+		defer stop()
+	}
 
-	for range 1000 {
-		if _, err := rand.Read(buf[:]); err != nil {
-			return 0, err
+	var tick <-chan time.Time
+	if progress != nil {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+
+		renderCountdown(progress, d)
+		defer fmt.Fprint(progress, "\r\033[K")
+	}
+
+	for {
+		select {
+		case <-timer.C:
+			if left := time.Until(deadline); left > 0 {
+				timer.Reset(left)
+				continue
+			}
+			return true
+		case <-interrupt:
+			return false
+		case <-resumed:
+			// Round(0) drops the monotonic reading, so remaining compares wall clocks.
+			left := remaining(wall.Add(d).Round(0), now().Round(0))
+			deadline = time.Now().Add(left)
+			timer.Reset(left)
+		case <-tick:
+			renderCountdown(progress, time.Until(deadline))
+		}
+	}
+}
+
+// remaining returns how long is left at t until deadline, or 0 once it has
+// passed.
+func remaining(deadline, t time.Time) time.Duration {
+	return max(deadline.Sub(t), 0)
+}
+
+// runHook runs the --pre-exec or --post-exec command s in a shell that
+// shares jsleep's standard streams.
+func runHook(name, s string) error {
+	cmd := shellCommand(s)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("--%s %q: %w", name, s, err)
+	}
+	return nil
+}
+
+// runSleep sleeps for d, spinning or also waiting for --pid-wait's process
+// if opts asks for it, and returns how long that actually took by the now
+// clock. ok is false if interrupt cut the sleep short.
+func runSleep(d time.Duration, opts options, interrupt <-chan os.Signal, progress io.Writer) (elapsed time.Duration, ok bool) {
+	start := now()
+	switch {
+	case opts.pidWait > 0:
+		if !sleepPid(d, opts.pidWait, opts.pidMode, interrupt) {
+			return now().Sub(start), false
 		}
-		v := binary.LittleEndian.Uint64(buf[:])
-		if v < limit {
-			return int64(v % uint64(n)), nil
+	case opts.spin && d < spinThreshold:
+		spin(d)
+	case opts.keys != nil:
+		if progress == nil {
+			progress = io.Discard
 		}
+		if !interactiveSleep(d, interrupt, opts.keys, progress) {
+			return now().Sub(start), false
+		}
+	case !sleep(d, sleepWall(start, opts), interrupt, progress):
+		return now().Sub(start), false
 	}
+	return now().Sub(start), true
+}
+
+// sleepWall returns the wall-clock start sleep resumes against, or the zero
+// Time under --cpu-affinity-safe.
+func sleepWall(start time.Time, opts options) time.Time {
+	if opts.monotonic {
+		return time.Time{}
+	}
+	return start
+}
+
+// spinThreshold is the longest sleep --spin busy-waits for. Anything longer
+// goes through the timer, whose granularity doesn't matter at that scale.
+const spinThreshold = 2 * time.Millisecond
+
+// spin busy-waits until d has elapsed. It keeps a CPU core fully busy the
+// whole time, in exchange for accuracy well below the timer's granularity.
+func spin(d time.Duration) {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+	}
+}
+
+// renderCountdown overwrites the current terminal line with the time left.
+func renderCountdown(w io.Writer, remaining time.Duration) {
+	fmt.Fprintf(w, "\rsleeping %s remaining...\033[K", max(remaining, 0).Round(100*time.Millisecond))
+}
+
+// isTerminal reports whether f is a character device such as a TTY.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `jsleep - jittered sleep
+
+Usage:
+  jsleep <duration>                    Default 50% jitter
+  jsleep <duration> <percent>          Positional percent jitter (e.g., 25%, -10%+50%)
+  jsleep <duration>... [<percent>]     Sum several durations (e.g., 1h 30m 20%)
+  jsleep <duration> --jitter <percent> Explicit percent jitter
+  jsleep <duration> --range <duration> Absolute jitter range (±duration)
+  jsleep - [<percent>]                 Read the base duration from stdin
+  jsleep --min <duration> --max <duration>
+  jsleep --until <time> [<percent>]    Sleep until a wall-clock time
+  jsleep --percent-of <duration> <percent>
+                                       Use percent of duration as the base
+  jsleep <duration> -- <command> [args...]   Run command after sleeping
+  jsleep sample [options] <duration> -n <count>
+                                       Print count sampled durations, one per
+                                       line, without sleeping
+  jsleep stream [options] <duration> [--rate <per-second>]
+                                       Print sampled durations, one per line,
+                                       until interrupted
+  jsleep cron <expr> [options]         Sleep until the next minute matching a
+                                       cron minute and hour (e.g., "*/15 9-17")
+  jsleep completion <bash|zsh|fish>    Print a shell completion script
+  jsleep bench-rng [--rng <name>] [--duration <duration>]
+                                       Report draws/sec of a random source
+
+Options:
+  -j, --jitter <percent>   Jitter as percent (e.g., 20%) or ratio (e.g., 0.2);
+                           defaults to 50%.
+                           Use signed parts for asymmetric jitter (e.g.,
+                           -10%+50% shrinks by up to 10%, grows by up to 50%).
+      --jitter-mode <mode> additive (default) or multiplicative: with
+                           multiplicative, -j 100% on 10s gives 10s/2 to 10s*2,
+                           keeping the geometric mean at the base.
+      --jitter-cap <duration>
+                           Limit percent jitter to duration either way of the
+                           base: -j 50% --jitter-cap 3s 1m samples 57s-63s.
+      --fixed              Sleep exactly the base duration, ignoring --jitter,
+                           --range, a positional percent, and JSLEEP_JITTER.
+  -r, --range <duration>   Absolute jitter range (e.g., 2s for +/- 2 seconds).
+                           A percent (e.g., 10%) is taken of the base duration.
+      --plus <duration>    Absolute jitter above the base, like one side of
+                           --range. Either may be given alone.
+      --minus <duration>   Absolute jitter below the base; it can't be more than
+                           the base. --plus 5s --minus 2s 10s samples 8s-15s.
+      --allow-zero-floor   Accept jitter that reaches below zero. The low end is
+                           always floored at 0, which piles extra probability
+                           onto 0; without this flag verbose mode warns about it.
+      --no-clamp-zero      Fail, showing the raw interval, instead of flooring
+                           an interval that reaches below zero at 0.
+      --strict-units       Reject durations without a unit, such as 10, instead
+                           of reading them as seconds (or JSLEEP_DEFAULT_UNIT).
+      --decimal-comma      Read commas in durations as decimal points, as in
+                           1,5s for 1.5s. Commas then no longer group digits.
+      --clamp-negative     Treat a negative base duration (e.g., -5s) as 0
+                           instead of rejecting it.
+      --offset <duration>  Shift the jittered interval by duration (may be
+                           negative) before --min and --max clamp it.
+      --cap-width <duration>
+                           If the jittered interval is wider than duration,
+                           narrow it to that width around its midpoint before
+                           --min and --max clamp it.
+
+  -u, --until <time>       Use the time until HH:MM, HH:MM:SS, an RFC3339
+                           timestamp, or +<duration> from now (e.g., +90m) as
+                           the base duration. Clock times roll over to
+                           tomorrow once they have passed today.
+      --base-file <path>   Read the base duration from path, and with --count
+                           read it again before every sleep, so it can be
+                           changed while jsleep runs.
+      --on-error <mode>    What to do when --base-file can't be read or parsed
+                           after the first sleep: fail (default), or skip and
+                           keep the last base.
+      --until-file <path>  Keep sleeping until path exists, checking before each
+                           sleep, and exit 0 once it does. Without --count,
+                           there is no limit on how many sleeps that takes; if
+                           the loop ends before path appears, jsleep fails.
+      --wait-for-tcp <host:port>
+                           Like --until-file, but keep sleeping until host:port
+                           accepts a TCP connection, trying after each sleep,
+                           so the wait is at least one sleep long.
+      --timeout <duration> With --until-file or --wait-for-tcp, give up and fail
+                           if it hasn't happened after duration in total.
+      --deadline <time>    Never sleep past a time given as for --until,
+                           cutting the sleep short even below --min. A clock
+                           time that has passed today means return at once.
+      --pid-wait <pid>     Also wait for process pid to exit, checking every
+                           100ms with signal 0. A process we may not signal
+                           still counts as running.
+      --pid-mode <mode>    With --pid-wait: later (default) returns once both
+                           the sleep and the process are done, earlier as
+                           soon as either is.
+      --percent-of <duration>
+                           Use the positional percent of duration as the base
+                           (e.g., --percent-of 30s 10% sleeps ~3s); jitter it
+                           with --jitter or --range.
 
-	return 0, errors.New("random number generation failed after too many attempts")
+  -m, --min <duration>     Clamp jitter result to this minimum (e.g., jsleep --min 9s 10s).
+  -M, --max <duration>     Clamp jitter result to this maximum.
+      --floor-percent <percent>
+                           Like --min, as a percent of the base duration
+                           (e.g., 80% keeps 10s at 8s or more).
+      --ceil-percent <percent>
+                           Like --max, as a percent of the base duration.
+      --clamp-mode <mode>  How --min and --max apply when there is a base
+                           duration: clip (default) cuts off the part of the
+                           interval outside them, shift slides the interval
+                           inside them, keeping its width where it fits.
+
+      --dist-file <path>   Instead of a base duration, pick one at random from
+                           the durations in path (one per line) for each
+                           sleep. Only jittered if --jitter or --range is
+                           given.
+      --choices <list>     Like --dist-file, with the durations given inline
+                           and separated by commas (e.g., 1s,5s,30s).
+  -d, --dist <name>        Sampling distribution: uniform (default), normal,
+                           triangular (peaking at the base duration), or
+                           exponential (with the base duration as its mean).
+      --at <percent>       Take every sleep at this percentile of the
+                           distribution instead of at random (e.g., 50% for
+                           the median, 90% for p90). No randomness is used.
+  -s, --seed <uint64>      Seed a deterministic PRNG instead of crypto/rand, so
+                           the same seed and bounds pick the same duration.
+                           Not cryptographically secure.
+      --seed-env <var>     Seed as --seed would with a hash of environment
+                           variable var, such as a CI run ID, so every run
+                           with the same value picks the same durations.
+      --warmup <k>         With --seed, draw and discard k durations before the
+                           first real one, to line up generator states.
+      --rng <name>         Random source: crypto (default, or math with
+                           --seed), pcg, or math. pcg and math are faster but
+                           not cryptographically secure; without --seed they
+                           are seeded from the clock.
+      --rng-retries <n>    Give up after n draws from crypto/rand without an
+                           unbiased value (default 1000).
+      --entropy-file <path>
+                           Read crypto's random bytes from path instead of
+                           crypto/rand, for reproducible tests of that path.
+                           Fails if the file runs out.
+
+  -v, --verbose            Print the chosen sleep duration to stderr, and after
+                           each sleep how long it actually took. Repeat for
+                           more: -vv adds the interval and distribution, and
+                           -vvv the random source, how many values were
+                           drawn from it for each sleep, and how many
+                           attempts it took, counting draws rejected to
+                           avoid modulo bias.
+      --format <template>  Print this Go text/template instead of the verbose
+                           "sleeping for" line, with fields .Chosen, .Low,
+                           .High, and .Unix (e.g., "{{.Chosen}} of
+                           [{{.Low}}, {{.High}}]"). The default is
+                           "sleeping for {{.Chosen}}".
+      --output-fd <n>      Write verbose, countdown, and warning output to the
+                           already-open file descriptor n (e.g., 3) instead
+                           of stderr. Errors still go to stderr.
+      --color <when>       Color verbose output: auto (default; only on a
+                           terminal, and only if NO_COLOR is unset), always,
+                           or never.
+  -q, --quiet              Print nothing but errors. Overrides --verbose,
+                           --json, --countdown, and warnings.
+      --clamp-report       Print the interval before and after clamping to stderr
+                           whenever --min, --max, or the zero floor change it.
+      --countdown          Show the time remaining on stderr when it is a
+                           terminal.
+      --interactive        When stdin and stderr are terminals, show the time
+                           remaining and read keys without waiting for Enter:
+                           p pauses the sleep, r resumes it, and s skips the
+                           rest of it. The terminal is restored on exit.
+      --drain              Read and discard stdin while sleeping, so a program
+                           piping into jsleep doesn't block on a full pipe.
+      --round <unit>       Round the chosen duration to the nearest multiple of
+                           unit (e.g., 1s, 100ms). Errors if that crosses
+                           --min or --max.
+      --floor <unit>       Like --round, but always round down.
+      --ceil <unit>        Like --round, but always round up.
+      --quantize <step>    Snap the chosen duration to the nearest multiple of
+                           step (e.g., 250ms) that is inside the interval,
+                           rounding the other way at its edges.
+      --align <unit>       Extend each sleep so it wakes on the next multiple
+                           of unit on the clock (e.g., 5s or 1m); jitter picks
+                           how far past the minimum that is.
+      --min-sleep <duration>
+                           Never sleep less than duration, whatever the jitter,
+                           clamping, and rounding chose. Unlike --min, this
+                           doesn't change the interval, so draws below it all
+                           sleep exactly duration. --max-total and --deadline
+                           can still cut a sleep shorter.
+      --pre-exec <cmd>     Run cmd with sh before each sleep; if it fails, jsleep
+                           exits without sleeping.
+      --post-exec <cmd>    Run cmd with sh after each sleep; if it fails, jsleep
+                           stops and exits with an error.
+      --exit-bucket <n>    Split the interval into n equal buckets and exit with
+                           10 plus the number (1 to n) of the one the chosen
+                           duration fell in, so 11 for the first. The offset
+                           keeps buckets clear of the failure statuses 1 to
+                           4, and n is at most 115, keeping them below 126.
+      --log-file <path>    Append a timestamped line with each chosen duration
+                           and its range to path.
+      --syslog             Send the verbose line for every sleep to the local
+                           syslog daemon at INFO priority, with or without -v.
+                           Not supported on Windows.
+      --syslog-tag <tag>   Tag for --syslog messages (default "jsleep").
+      --state-file <path>  Write the wake time to path before sleeping, and
+                           delete it once the sleep is over. If path already
+                           holds a wake time still in the future, as after a
+                           restart mid-sleep, sleep only until then instead.
+                           Requires --count 1.
+      --metrics-file <path>
+                           After each sleep, atomically replace path with
+                           jsleep_chosen_seconds, jsleep_low_seconds, and
+                           jsleep_high_seconds gauges in Prometheus text format.
+      --json               Print the bounds and chosen duration to stdout as JSON.
+      --duration-format <style>
+                           Print durations in verbose, --json, --stats,
+                           sample, and stream output as go (e.g., 1m30.5s, unrounded), ns (a
+                           count of nanoseconds), or human (1 minute 30.5
+                           seconds). By default verbose output rounds to the
+                           millisecond.
+      --report-json-on-signal
+                           If SIGINT cuts a sleep short, print
+                           {"chosen_ns":...,"elapsed_ns":...,"interrupted":true}
+                           to stdout before exiting with status 130.
+  -c, --count <n>          Sleep n times, drawing a new duration each time; 0 or
+                           inf repeats forever. Defaults to 1.
+      --jobs <n>           Run n sleeps at once, each with its own jittered
+                           duration, and wait for the last; verbose mode
+                           prints each job's duration.
+      --probability <percent>
+                           Only sleep this percent of the time (e.g., 30%),
+                           returning at once otherwise. Verbose mode still
+                           prints the duration that was drawn.
+      --max-total <duration>
+                           Stop once the total time slept reaches this budget,
+                           shortening the final sleep to fit.
+      --warn-above <duration>
+                           Warn on stderr when a chosen sleep is longer than
+                           duration, to catch typos like 10m for 10ms.
+      --strict             With --warn-above, exit with an error before the
+                           sleep instead of warning. Also makes a --max below
+                           the base duration, as in --max 5s 10s, an error
+                           rather than a warning under -v.
+      --backoff            Grow the base by --backoff-factor on each --count
+                           iteration, capped at --max, jittering every step.
+      --backoff-factor <f> Backoff multiplier; defaults to 2.
+      --stats <n>          Print a summary of n sampled durations to stdout
+                           (min, max, mean, median, p50, p90, p99) instead of
+                           sleeping.
+      --hist <n>           Print an ASCII histogram of n sampled durations to
+                           stdout instead of sleeping, sized to $COLUMNS.
+  -n, --dry-run            Print the chosen duration to stderr without sleeping
+                           or running the command.
+      --explain            Like --dry-run, but also resolve the command through
+                           $PATH and print its absolute path and argv to stdout
+                           as path= and argv= lines instead of running it.
+      --skip-if-ci         In CI, print the chosen duration as --dry-run does
+                           and go straight on to the command, if any, without
+                           sleeping. Sleeps as usual everywhere else.
+      --ci-env <vars>      Comma-separated environment variables whose being
+                           set means --skip-if-ci is in CI (default
+                           CI,GITHUB_ACTIONS).
+      --dump-args          Print the resolved base, jitter and where it came
+                           from, interval, clamps, distribution, and random
+                           source as key=value lines to stdout, and exit.
+      --ignore-signals     Don't handle SIGINT; by default an interrupted sleep
+                           exits with status 130.
+      --spin               Busy-wait instead of using a timer for sleeps under
+                           2ms. More accurate, but keeps a CPU core busy and
+                           can't be interrupted.
+      --cpu-affinity-safe  Measure sleeps only on the monotonic clock. Either
+                           way setting the wall clock doesn't move a sleep's
+                           end, but by default a sleep continued after a system
+                           suspend catches up to the wall clock; with this it
+                           runs its full length on the monotonic clock, which
+                           some systems pause while suspended.
+      --config <path>      Read default option values from path, one
+                           name=value per line (e.g., jitter=20%). Defaults
+                           to ~/.config/jsleep/config if it exists. Options on
+                           the command line take precedence.
+      --spec <path>        Read option values from a JSON object in path, as
+                           in {"base":"10s","jitter":"20%"}; "base" is the
+                           duration when none is given. Overrides the config
+                           file; options on the command line take precedence.
+  -h, --help               Show this help.
+
+Environment:
+  JSLEEP_JITTER            Jitter to use when none is given on the command line.
+  JSLEEP_DEFAULT_UNIT      Unit for bare numbers (e.g., ms); defaults to s.
+  NO_COLOR                 Disable color in --color auto mode.
+
+Exit status:
+  0 success, 1 other failure, 2 invalid command line, 3 random number
+  generation failed, 4 empty interval after clamping, 130 interrupted.
+  With --exit-bucket, a successful run exits with 10 plus the bucket number.
+`)
 }
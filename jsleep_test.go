@@ -1,78 +1,208 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/thomasdesr/jsleep/jitter"
 )
 
-func TestParseDuration(t *testing.T) {
+// TestMain keeps the tests away from the environment they run in: HOME is
+// an empty directory, so no user config file is loaded, and the JSLEEP_*
+// variables that change parsing are unset.
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "jsleep-home")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("USERPROFILE", home)
+	os.Unsetenv("JSLEEP_JITTER")
+	os.Unsetenv("JSLEEP_DEFAULT_UNIT")
+
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+func TestFormatDuration(t *testing.T) {
+	const sample = time.Hour + 2*time.Minute + 3500*time.Millisecond + 7
 	tests := []struct {
-		input   string
-		want    time.Duration
-		wantErr bool
+		d     time.Duration
+		style string
+		want  string
 	}{
-		{"5", 5 * time.Second, false},
-		{"100", 100 * time.Second, false},
-		{"100ms", 100 * time.Millisecond, false},
-		{"1m", time.Minute, false},
-		{"1h", time.Hour, false},
-		{"2d", 48 * time.Hour, false},
-		{"0.5d", 12 * time.Hour, false},
-		{"1.5h", 90 * time.Minute, false},
-		{"", 0, true},
-		{"abc", 0, true},
-		{"d", 0, true},
-		{"1e308d", 0, true},
-		{"-1e308d", 0, true},
+		{sample, "", "1h2m3.500000007s"},
+		{sample, "go", "1h2m3.500000007s"},
+		{sample, "ns", "3723500000007"},
+		{sample, "human", "1 hour 2 minutes 3.500000007 seconds"},
+		{8 * time.Second, "human", "8 seconds"},
+		{time.Second, "human", "1 second"},
+		{90 * time.Second, "human", "1 minute 30 seconds"},
+		{2 * time.Hour, "human", "2 hours"},
+		{1500 * time.Microsecond, "human", "1.5 milliseconds"},
+		{time.Microsecond, "human", "1 microsecond"},
+		{12, "human", "12 nanoseconds"},
+		{0, "human", "0 seconds"},
+		{-8 * time.Second, "human", "-8 seconds"},
+		{0, "ns", "0"},
 	}
-
 	for _, tt := range tests {
-		t.Run(tt.input, func(t *testing.T) {
-			got, err := parseDuration(tt.input)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("parseDuration(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
-				return
-			}
-			if !tt.wantErr && got != tt.want {
-				t.Errorf("parseDuration(%q) = %v, want %v", tt.input, got, tt.want)
-			}
-		})
+		if got := formatDuration(tt.d, tt.style); got != tt.want {
+			t.Errorf("formatDuration(%d, %q) = %q, want %q", tt.d, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestRunDurationFormat(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-n", "-v", "--json", "--duration-format", "ns", "-j", "0%", "1.5s"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := stderr.String(); got != "sleeping for 1500000000\n" {
+		t.Errorf("verbose output = %q, want nanoseconds", got)
+	}
+	var got sleepReport
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Chosen != "1500000000" {
+		t.Errorf("JSON chosen = %q, want nanoseconds", got.Chosen)
+	}
+
+	stdout.Reset()
+	if err := run([]string{"--stats", "10", "--duration-format", "human", "-j", "0%", "8s"}, &stdout, new(bytes.Buffer)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "median=8 seconds\n") {
+		t.Errorf("stats output = %q, want human durations", stdout.String())
+	}
+
+	for style, want := range map[string]string{"ns": "1500000000\n", "human": "1.5 seconds\n"} {
+		stdout.Reset()
+		if err := run([]string{"sample", "--duration-format", style, "-n", "2", "-j", "0%", "1.5s"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run sample: %v", err)
+		}
+		if got := stdout.String(); got != want+want {
+			t.Errorf("sample --duration-format %s output = %q, want %q twice", style, got, want)
+		}
+
+		opts, err := parseArgs([]string{"--duration-format", style, "-j", "0%", "1.5s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout.Reset()
+		stop := make(chan os.Signal, 1)
+		stop <- os.Interrupt
+		if err := streamSamples(&stdout, opts, 0, stop); err != nil {
+			t.Fatalf("streamSamples: %v", err)
+		}
+		if got := stdout.String(); got != want {
+			t.Errorf("stream --duration-format %s output = %q, want %q", style, got, want)
+		}
+	}
+
+	if _, err := parseArgs([]string{"--duration-format", "roman", "10s"}); err == nil {
+		t.Error("parseArgs accepted an unknown --duration-format")
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	opts, err := parseArgs([]string{"--json", "-v", "10s"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !opts.json || opts.verbose != 1 {
+		t.Fatalf("json = %v, verbose = %v, want both set", opts.json, opts.verbose)
+	}
+
+	chosen, err := jitter.ChooseSleepDurationAround(opts.low, opts.high, opts.base, opts.dist, opts.rand)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, opts.low, opts.high, chosen, chosen, ""); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("output has %d lines, want 1: %q", n, buf.String())
+	}
+
+	var got sleepReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshal %q: %v", buf.String(), err)
+	}
+	if got.LowNs != int64(opts.low) || got.HighNs != int64(opts.high) {
+		t.Errorf("bounds = [%d, %d], want [%d, %d]", got.LowNs, got.HighNs, opts.low, opts.high)
+	}
+	if got.ChosenNs < got.LowNs || got.ChosenNs > got.HighNs {
+		t.Errorf("chosen_ns = %d, want in [%d, %d]", got.ChosenNs, got.LowNs, got.HighNs)
+	}
+	if got.Chosen != time.Duration(got.ChosenNs).String() {
+		t.Errorf("chosen = %q, want %q", got.Chosen, time.Duration(got.ChosenNs))
 	}
 }
 
-func TestParsePercent(t *testing.T) {
+func TestParseUntil(t *testing.T) {
+	ref := time.Date(2024, time.March, 10, 8, 30, 0, 0, time.UTC)
+
 	tests := []struct {
 		input   string
-		want    float64
+		want    time.Duration
 		wantErr bool
 	}{
-		{"25%", 0.25, false},
-		{"0%", 0.0, false},
-		{"100%", 1.0, false},
-		{"50%", 0.5, false},
-		{"12.5%", 0.125, false},
-		{"50", 0, true},
-		{"-10%", 0, true},
-		{"abc%", 0, true},
-		{"%", 0, true},
+		{"09:00", 30 * time.Minute, false},
+		{"09:00:30", 30*time.Minute + 30*time.Second, false},
+		{"08:30", 24 * time.Hour, false},
+		{"08:00", 23*time.Hour + 30*time.Minute, false},
+		{"2024-03-10T10:00:00Z", 90 * time.Minute, false},
+		{"2024-03-10T10:00:00+01:00", 30 * time.Minute, false},
+		{"2024-03-10T08:00:00Z", 0, false},
+		{"+90m", 90 * time.Minute, false},
+		{"+1h30m", 90 * time.Minute, false},
+		{"+0s", 0, false},
+		{"+1d", 24 * time.Hour, false},
+		{"+", 0, true},
+		{"+soon", 0, true},
+		{"25:00", 0, true},
+		{"9am", 0, true},
+		{"", 0, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			got, err := parsePercent(tt.input)
+			got, err := parseUntil(tt.input, ref, jitter.DurationParser{})
 			if (err != nil) != tt.wantErr {
-				t.Errorf("parsePercent(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				t.Errorf("parseUntil(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
 				return
 			}
 			if !tt.wantErr && got != tt.want {
-				t.Errorf("parsePercent(%q) = %v, want %v", tt.input, got, tt.want)
+				t.Errorf("parseUntil(%q) = %v, want %v", tt.input, got, tt.want)
 			}
 		})
 	}
 }
 
-func TestParseArgs(t *testing.T) {
+func TestParseArgsUntil(t *testing.T) {
+	ref := time.Date(2024, time.March, 10, 8, 50, 0, 0, time.Local)
+	now = func() time.Time { return ref }
+	t.Cleanup(func() { now = time.Now })
+
 	tests := []struct {
 		name    string
 		args    []string
@@ -81,76 +211,67 @@ func TestParseArgs(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:    "default 50% jitter",
-			args:    []string{"10s"},
-			wantLow: 5 * time.Second,
-			wantHi:  15 * time.Second,
+			name:    "no jitter",
+			args:    []string{"--until", "09:00", "-j", "0%"},
+			wantLow: 10 * time.Minute,
+			wantHi:  10 * time.Minute,
 		},
 		{
-			name:    "explicit jitter flag",
-			args:    []string{"-j", "20%", "10s"},
-			wantLow: 8 * time.Second,
-			wantHi:  12 * time.Second,
+			name:    "default jitter",
+			args:    []string{"--until", "09:00"},
+			wantLow: 5 * time.Minute,
+			wantHi:  15 * time.Minute,
 		},
 		{
 			name:    "positional jitter",
-			args:    []string{"10s", "20%"},
-			wantLow: 8 * time.Second,
-			wantHi:  12 * time.Second,
-		},
-		{
-			name:    "range jitter",
-			args:    []string{"-r", "2s", "10s"},
-			wantLow: 8 * time.Second,
-			wantHi:  12 * time.Second,
-		},
-		{
-			name:    "bounds only",
-			args:    []string{"--min", "5s", "--max", "15s"},
-			wantLow: 5 * time.Second,
-			wantHi:  15 * time.Second,
+			args:    []string{"--until", "09:00", "10%"},
+			wantLow: 9 * time.Minute,
+			wantHi:  11 * time.Minute,
 		},
 		{
-			name:    "zero jitter",
-			args:    []string{"-j", "0%", "10s"},
-			wantLow: 10 * time.Second,
-			wantHi:  10 * time.Second,
+			name:    "range",
+			args:    []string{"--until", "09:00", "-r", "1m"},
+			wantLow: 9 * time.Minute,
+			wantHi:  11 * time.Minute,
 		},
 		{
-			name:    "missing duration",
-			args:    []string{},
-			wantErr: true,
+			name:    "relative",
+			args:    []string{"--until", "+90m", "-j", "0%"},
+			wantLow: 90 * time.Minute,
+			wantHi:  90 * time.Minute,
 		},
 		{
-			name:    "jitter and range conflict",
-			args:    []string{"-j", "20%", "-r", "2s", "10s"},
-			wantErr: true,
+			name:    "relative with jitter",
+			args:    []string{"--until", "+10m", "10%"},
+			wantLow: 9 * time.Minute,
+			wantHi:  11 * time.Minute,
 		},
 		{
-			name:    "max less than min",
-			args:    []string{"--min", "10s", "--max", "5s"},
-			wantErr: true,
+			name:    "relative with decimal comma",
+			args:    []string{"--decimal-comma", "--until", "+1,5m", "-j", "0%"},
+			wantLow: 90 * time.Second,
+			wantHi:  90 * time.Second,
 		},
 		{
-			name:    "positional and flag jitter conflict",
-			args:    []string{"-j", "20%", "10s", "30%"},
+			name:    "relative bare number under strict units",
+			args:    []string{"--strict-units", "--until", "+90"},
 			wantErr: true,
 		},
 		{
-			name:    "range without base",
-			args:    []string{"-r", "2s"},
+			name:    "positional duration conflict",
+			args:    []string{"--until", "09:00", "10s"},
 			wantErr: true,
 		},
 		{
-			name:    "min/max conflict with base",
-			args:    []string{"--min", "10s", "--max", "5s", "10s"},
+			name:    "positional duration and jitter conflict",
+			args:    []string{"--until", "09:00", "10s", "10%"},
 			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			low, high, _, err := parseArgs(tt.args)
+			opts, err := parseArgs(tt.args)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
 				return
@@ -158,82 +279,2960 @@ func TestParseArgs(t *testing.T) {
 			if tt.wantErr {
 				return
 			}
-			if low != tt.wantLow {
-				t.Errorf("parseArgs(%v) low = %v, want %v", tt.args, low, tt.wantLow)
+			if opts.low != tt.wantLow || opts.high != tt.wantHi {
+				t.Errorf("parseArgs(%v) = [%v, %v], want [%v, %v]", tt.args, opts.low, opts.high, tt.wantLow, tt.wantHi)
+			}
+		})
+	}
+
+	t.Setenv("JSLEEP_DEFAULT_UNIT", "m")
+	opts, err := parseArgs([]string{"--until", "+90", "-j", "0%"})
+	if err != nil || opts.base != 90*time.Minute {
+		t.Errorf("--until +90 with JSLEEP_DEFAULT_UNIT=m: base = %v, %v, want 1h30m0s", opts.base, err)
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	ref := time.Date(2024, time.March, 10, 8, 59, 0, 0, time.Local)
+	now = func() time.Time { return ref }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"truncated below low", []string{"-n", "--deadline", "09:00", "--min", "2m", "--max", "3m"}, "sleeping for 1m0s"},
+		{"not reached", []string{"-n", "--deadline", "09:00", "-j", "0%", "30s"}, "sleeping for 30s"},
+		{"RFC3339", []string{"-n", "--deadline", ref.Add(10 * time.Second).Format(time.RFC3339), "1h"}, "sleeping for 10s"},
+		{"relative", []string{"-n", "--deadline", "+20s", "1h"}, "sleeping for 20s"},
+		{"already past", []string{"-v", "--deadline", "08:00", "1h"}, "sleeping for 0s"},
+		{"stops the loop", []string{"-n", "--count", "inf", "--deadline", "08:00", "1h"}, "sleeping for 0s (iteration 1)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			if err := run(tt.args, new(bytes.Buffer), &stderr); err != nil {
+				t.Fatalf("run(%v): %v", tt.args, err)
 			}
-			if high != tt.wantHi {
-				t.Errorf("parseArgs(%v) high = %v, want %v", tt.args, high, tt.wantHi)
+			if got := strings.TrimSpace(strings.SplitN(stderr.String(), "\n", 2)[0]); got != tt.want {
+				t.Errorf("run(%v) printed %q, want %q", tt.args, got, tt.want)
 			}
 		})
 	}
+
+	if _, err := parseArgs([]string{"--deadline", "noon", "10s"}); err == nil {
+		t.Error("parseArgs with an invalid --deadline succeeded, want error")
+	}
 }
 
-func TestParseArgsInvariants(t *testing.T) {
-	validArgSets := [][]string{
-		{"10s"},
-		{"10s", "25%"},
-		{"-j", "30%", "5s"},
-		{"-r", "1s", "10s"},
-		{"--min", "1s", "--max", "10s"},
-		{"--min", "5s", "10s"},
-		{"--max", "15s", "10s"},
-		{"--min", "8s", "--max", "12s", "10s"},
+func TestAlignDuration(t *testing.T) {
+	ref := time.Unix(1_700_000_002, 250_000_000)
+	tests := []struct {
+		name string
+		d    time.Duration
+		unit time.Duration
+		want time.Duration
+	}{
+		{"extends to boundary", 10 * time.Second, 5 * time.Second, 12*time.Second + 750*time.Millisecond},
+		{"already on boundary", 2*time.Second + 750*time.Millisecond, 5 * time.Second, 2*time.Second + 750*time.Millisecond},
+		{"minute", time.Second, time.Minute, 37*time.Second + 750*time.Millisecond},
+		{"saturates", math.MaxInt64 - time.Millisecond, time.Hour, math.MaxInt64 - time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alignDuration(tt.d, tt.unit, ref); got != tt.want {
+				t.Errorf("alignDuration(%s, %s) = %s, want %s", tt.d, tt.unit, got, tt.want)
+			}
+		})
 	}
+}
 
-	for _, args := range validArgSets {
-		t.Run(strings.Join(args, "_"), func(t *testing.T) {
-			low, high, _, err := parseArgs(args)
+func TestRunAlign(t *testing.T) {
+	ref := time.Unix(1_700_000_000, 123_456_789)
+	now = func() time.Time { return ref }
+	t.Cleanup(func() { now = time.Now })
+
+	const unit = 7 * time.Second
+	var stdout bytes.Buffer
+	if err := run([]string{"-n", "--json", "--count", "20", "--align", "7s", "-j", "50%", "10s"}, &stdout, new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	dec := json.NewDecoder(&stdout)
+	for dec.More() {
+		var got sleepReport
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		chosen := time.Duration(got.ChosenNs)
+		if wake := ref.Add(chosen).UnixNano(); wake%int64(unit) != 0 {
+			t.Errorf("waking at %d after %s, want a multiple of %s", wake, chosen, unit)
+		}
+		if chosen < 5*time.Second || chosen >= 15*time.Second+unit {
+			t.Errorf("chosen %s outside [5s, 22s)", chosen)
+		}
+	}
+
+	for _, args := range [][]string{{"--align", "0s", "10s"}, {"--align", "soon", "10s"}, {"--jobs", "2", "--align", "5s", "10s"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunMinSleep(t *testing.T) {
+	for _, args := range [][]string{
+		{"-j", "100%", "0s"},
+		{"-j", "100%", "500ms"},
+		{"--round", "1m", "-j", "100%", "10s"},
+	} {
+		var stdout bytes.Buffer
+		args = append([]string{"-n", "--json", "--count", "50", "--min-sleep", "1s"}, args...)
+		if err := run(args, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run(%v): %v", args, err)
+		}
+		dec := json.NewDecoder(&stdout)
+		for dec.More() {
+			var got sleepReport
+			if err := dec.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if chosen := time.Duration(got.ChosenNs); chosen < time.Second {
+				t.Errorf("run(%v) chose %s, want at least 1s", args, chosen)
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"--min-sleep", "-1s", "10s"}, {"--min-sleep", "soon", "10s"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunWaitForTCP(t *testing.T) {
+	// closedAddr returns a loopback address with nothing listening on it.
+	closedAddr := func(t *testing.T) string {
+		t.Helper()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr := ln.Addr().String()
+		ln.Close()
+		return addr
+	}
+
+	t.Run("listener opens after a delay", func(t *testing.T) {
+		addr := closedAddr(t)
+		opened := make(chan net.Listener, 1)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			ln, err := net.Listen("tcp", addr)
 			if err != nil {
-				t.Errorf("parseArgs(%v) unexpected error: %v", args, err)
+				t.Error(err)
+				ln = nil
+			}
+			opened <- ln
+		}()
+		t.Cleanup(func() {
+			if ln := <-opened; ln != nil {
+				ln.Close()
+			}
+		})
+
+		var stdout bytes.Buffer
+		start := time.Now()
+		if err := run([]string{"--json", "--wait-for-tcp", addr, "--timeout", "5s", "-j", "0%", "20ms"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("returned after %v, before the listener opened", elapsed)
+		}
+		if n := strings.Count(stdout.String(), "\n"); n < 2 {
+			t.Errorf("slept %d times, want several while the port was closed", n)
+		}
+	})
+
+	t.Run("already listening", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		var stdout bytes.Buffer
+		if err := run([]string{"--json", "--wait-for-tcp", ln.Addr().String(), "-j", "0%", "1ms"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if n := strings.Count(stdout.String(), "\n"); n != 1 {
+			t.Errorf("slept %d times, want just the one", n)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		err := run([]string{"--wait-for-tcp", closedAddr(t), "--timeout", "50ms", "-j", "0%", "10ms"}, new(bytes.Buffer), new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), "did not accept a connection") {
+			t.Errorf("run = %v, want a did not accept a connection error", err)
+		}
+	})
+
+	t.Run("count runs out", func(t *testing.T) {
+		err := run([]string{"--wait-for-tcp", closedAddr(t), "--count", "1", "1ms"}, new(bytes.Buffer), new(bytes.Buffer))
+		if err == nil {
+			t.Error("run succeeded without the port accepting a connection")
+		}
+	})
+
+	for _, args := range [][]string{
+		{"--wait-for-tcp", "localhost", "10s"},
+		{"--wait-for-tcp", "localhost:5432", "--until-file", "/tmp/ready", "10s"},
+		{"--wait-for-tcp", "localhost:5432", "--jobs", "2", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunBaseFile(t *testing.T) {
+	// chosen returns the "chosen" field of each --json line in out.
+	chosen := func(t *testing.T, out string) []string {
+		t.Helper()
+		var got []string
+		for line := range strings.Lines(out) {
+			var r sleepReport
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("bad --json line %q: %v", line, err)
+			}
+			got = append(got, r.Chosen)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name     string
+		postExec string
+		onError  string
+		want     []string
+		wantErr  bool
+	}{
+		{"changes between sleeps", "echo 2ms >", "fail", []string{"1ms", "2ms", "2ms"}, false},
+		{"unparseable fails", "echo soon >", "fail", []string{"1ms"}, true},
+		{"unparseable skipped", "echo soon >", "skip", []string{"1ms", "1ms", "1ms"}, false},
+		{"missing skipped", "rm -f", "skip", []string{"1ms", "1ms", "1ms"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "base")
+			if err := os.WriteFile(path, []byte("1ms\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			args := []string{"--json", "--count", "3", "-j", "0%", "--base-file", path, "--on-error", tt.onError, "--post-exec", tt.postExec + " " + path}
+			err := run(args, &stdout, new(bytes.Buffer))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run(%v) error = %v, wantErr %v", args, err, tt.wantErr)
+			}
+			if got := chosen(t, stdout.String()); !slices.Equal(got, tt.want) {
+				t.Errorf("slept %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Everything resolved relative to the base has to follow it.
+	relative := []struct {
+		name     string
+		args     []string
+		wantLow  time.Duration
+		wantHigh time.Duration
+		wantErr  bool
+	}{
+		{"percent range", []string{"-r", "10%"}, 9 * time.Millisecond, 11 * time.Millisecond, false},
+		{"floor percent", []string{"--floor-percent", "100%"}, 10 * time.Millisecond, 15 * time.Millisecond, false},
+		{"minus past the base", []string{"--minus", "15ms", "--plus", "1ms"}, 0, 0, true},
+	}
+	for _, tt := range relative {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "base")
+			if err := os.WriteFile(path, []byte("20ms"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			args := slices.Concat([]string{"--json", "--count", "2", "--base-file", path, "--post-exec", "echo 10ms > " + path}, tt.args)
+			err := run(args, &stdout, new(bytes.Buffer))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run(%v) error = %v, wantErr %v", args, err, tt.wantErr)
+			}
+			if tt.wantErr {
 				return
 			}
-			if low > high {
-				t.Errorf("parseArgs(%v) low=%v > high=%v", args, low, high)
+			lines := slices.Collect(strings.Lines(stdout.String()))
+			if len(lines) != 2 {
+				t.Fatalf("got %d --json lines, want 2: %q", len(lines), stdout.String())
 			}
-			if low < 0 {
-				t.Errorf("parseArgs(%v) low=%v < 0", args, low)
+			var r sleepReport
+			if err := json.Unmarshal([]byte(lines[1]), &r); err != nil {
+				t.Fatal(err)
 			}
-			if high < 0 {
-				t.Errorf("parseArgs(%v) high=%v < 0", args, high)
+			if low, high := time.Duration(r.LowNs), time.Duration(r.HighNs); low != tt.wantLow || high != tt.wantHigh {
+				t.Errorf("after the base changed to 10ms, interval = [%s, %s], want [%s, %s]", low, high, tt.wantLow, tt.wantHigh)
 			}
 		})
 	}
+
+	path := filepath.Join(t.TempDir(), "base")
+	if err := os.WriteFile(path, []byte("10s"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"--base-file", filepath.Join(t.TempDir(), "missing")},
+		{"--base-file", path, "10s"},
+		{"--base-file", path, "--until", "+1m"},
+		{"--base-file", path, "--on-error", "retry"},
+		{"--on-error", "skip", "10s"},
+		{"--on-error", "fail", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
 }
 
-func TestChooseSleepDuration(t *testing.T) {
-	t.Run("equal bounds", func(t *testing.T) {
-		got, err := chooseSleepDuration(5*time.Second, 5*time.Second)
-		if err != nil {
-			t.Fatalf("unexpected error: %v", err)
+func TestRunUntilFile(t *testing.T) {
+	dir := t.TempDir()
+	sentinel := filepath.Join(dir, "ready")
+
+	t.Run("created after the first sleep", func(t *testing.T) {
+		var stdout bytes.Buffer
+		args := []string{"--json", "--until-file", sentinel, "--post-exec", "touch " + sentinel, "-j", "0%", "1ms"}
+		if err := run(args, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run: %v", err)
 		}
-		if got != 5*time.Second {
-			t.Errorf("got %v, want 5s", got)
+		if n := strings.Count(stdout.String(), "\n"); n != 1 {
+			t.Errorf("slept %d times, want 1 before the file appeared", n)
 		}
 	})
 
-	t.Run("in bounds", func(t *testing.T) {
-		low := 5 * time.Second
-		high := 15 * time.Second
-		for i := 0; i < 100; i++ {
-			got, err := chooseSleepDuration(low, high)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if got < low || got > high {
-				t.Errorf("iteration %d: got %v, want in [%v, %v]", i, got, low, high)
-			}
+	t.Run("already there", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if err := run([]string{"--json", "--until-file", sentinel, "1h"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("slept despite the file existing: %q", stdout.String())
 		}
 	})
 
-	t.Run("non-negative", func(t *testing.T) {
-		for i := 0; i < 100; i++ {
-			got, err := chooseSleepDuration(0, 10*time.Second)
-			if err != nil {
-				t.Fatalf("unexpected error: %v", err)
-			}
-			if got < 0 {
-				t.Errorf("iteration %d: got %v < 0", i, got)
+	t.Run("timeout", func(t *testing.T) {
+		missing := filepath.Join(dir, "never")
+		start := time.Now()
+		err := run([]string{"--until-file", missing, "--timeout", "50ms", "-j", "0%", "10ms"}, new(bytes.Buffer), new(bytes.Buffer))
+		if err == nil || !strings.Contains(err.Error(), "did not appear") {
+			t.Errorf("run = %v, want a did not appear error", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("--timeout 50ms took %v", elapsed)
+		}
+	})
+
+	t.Run("count runs out", func(t *testing.T) {
+		for _, count := range []string{"2", "1"} {
+			err := run([]string{"--until-file", filepath.Join(dir, "never"), "--count", count, "1ms"}, new(bytes.Buffer), new(bytes.Buffer))
+			if err == nil {
+				t.Errorf("--count %s: run succeeded without the file appearing", count)
 			}
 		}
 	})
+
+	for _, args := range [][]string{{"--timeout", "1m", "10s"}, {"--until-file", sentinel, "--timeout", "0s", "10s"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestParseArgsStdin(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		args    []string
+		wantLow time.Duration
+		wantHi  time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "default jitter",
+			input:   "10s\n",
+			args:    []string{"-"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "positional jitter",
+			input:   "  10s extra tokens",
+			args:    []string{"-", "20%"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "jitter flag",
+			input:   "10",
+			args:    []string{"-j", "0%", "-"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "empty",
+			input:   " \n",
+			args:    []string{"-"},
+			wantErr: true,
+		},
+		{
+			name:    "unparseable",
+			input:   "soon",
+			args:    []string{"-"},
+			wantErr: true,
+		},
+	}
+
+	t.Cleanup(func() { stdin = os.Stdin })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin = strings.NewReader(tt.input)
+			opts, err := parseArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if opts.low != tt.wantLow || opts.high != tt.wantHi {
+				t.Errorf("parseArgs(%v) = [%v, %v], want [%v, %v]", tt.args, opts.low, opts.high, tt.wantLow, tt.wantHi)
+			}
+		})
+	}
+}
+
+func TestParseArgsEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		jitter  string
+		unit    string
+		args    []string
+		wantLow time.Duration
+		wantHi  time.Duration
+		wantErr string
+	}{
+		{
+			name:    "unset",
+			args:    []string{"10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "env jitter",
+			jitter:  "20%",
+			args:    []string{"10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "flag overrides env jitter",
+			jitter:  "20%",
+			args:    []string{"-j", "10%", "10s"},
+			wantLow: 9 * time.Second,
+			wantHi:  11 * time.Second,
+		},
+		{
+			name:    "positional overrides env jitter",
+			jitter:  "20%",
+			args:    []string{"10s", "0%"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "range overrides env jitter",
+			jitter:  "20%",
+			args:    []string{"-r", "1s", "10s"},
+			wantLow: 9 * time.Second,
+			wantHi:  11 * time.Second,
+		},
+		{
+			name:    "fixed overrides env jitter",
+			jitter:  "20%",
+			args:    []string{"--fixed", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "invalid env jitter",
+			jitter:  "abc",
+			args:    []string{"10s"},
+			wantErr: "JSLEEP_JITTER",
+		},
+		{
+			name:    "env unit",
+			unit:    "ms",
+			args:    []string{"-j", "0%", "500"},
+			wantLow: 500 * time.Millisecond,
+			wantHi:  500 * time.Millisecond,
+		},
+		{
+			name:    "explicit unit overrides env unit",
+			unit:    "ms",
+			args:    []string{"-j", "0%", "--max", "2", "5s"},
+			wantLow: 2 * time.Millisecond,
+			wantHi:  2 * time.Millisecond,
+		},
+		{
+			name:    "invalid env unit",
+			unit:    "fortnights",
+			args:    []string{"10s"},
+			wantErr: "JSLEEP_DEFAULT_UNIT",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JSLEEP_JITTER", tt.jitter)
+			t.Setenv("JSLEEP_DEFAULT_UNIT", tt.unit)
+
+			opts, err := parseArgs(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseArgs(%v) error = %v, want mention of %s", tt.args, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseArgs(%v) unexpected error: %v", tt.args, err)
+			}
+			if opts.low != tt.wantLow || opts.high != tt.wantHi {
+				t.Errorf("parseArgs(%v) = [%v, %v], want [%v, %v]", tt.args, opts.low, opts.high, tt.wantLow, tt.wantHi)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantLow time.Duration
+		wantHi  time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "default 50% jitter",
+			args:    []string{"10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "explicit jitter flag",
+			args:    []string{"-j", "20%", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "jitter ratio",
+			args:    []string{"--jitter", "0.2", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "positional jitter",
+			args:    []string{"10s", "20%"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "range jitter",
+			args:    []string{"-r", "2s", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "percent range",
+			args:    []string{"--range", "10%", "20s"},
+			wantLow: 18 * time.Second,
+			wantHi:  22 * time.Second,
+		},
+		{
+			name:    "percent range with jitter",
+			args:    []string{"-j", "20%", "-r", "10%", "20s"},
+			wantErr: true,
+		},
+		{
+			name:    "percent range with positional jitter",
+			args:    []string{"-r", "10%", "20s", "20%"},
+			wantErr: true,
+		},
+		{
+			name:    "floor percent",
+			args:    []string{"-j", "50%", "--floor-percent", "80%", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "floor and ceil percent",
+			args:    []string{"--floor-percent", "80%", "--ceil-percent", "120%", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "ceil percent with until",
+			args:    []string{"--until", "+10m", "--ceil-percent", "110%"},
+			wantLow: 5 * time.Minute,
+			wantHi:  11 * time.Minute,
+		},
+		{
+			name:    "floor percent with min",
+			args:    []string{"--floor-percent", "80%", "--min", "9s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "ceil percent without base",
+			args:    []string{"--ceil-percent", "120%", "--min", "1s", "--max", "2s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid floor percent",
+			args:    []string{"--floor-percent", "80", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "multiplicative jitter",
+			args:    []string{"-j", "100%", "--jitter-mode", "multiplicative", "10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  20 * time.Second,
+		},
+		{
+			name:    "multiplicative positional jitter",
+			args:    []string{"--jitter-mode", "multiplicative", "10s", "-20%+50%"},
+			wantLow: 8333333333,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "multiplicative with range",
+			args:    []string{"--jitter-mode", "multiplicative", "-r", "2s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown jitter mode",
+			args:    []string{"--jitter-mode", "geometric", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "strict units",
+			args:    []string{"--strict-units", "-j", "0%", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "strict units without a unit",
+			args:    []string{"--strict-units", "10"},
+			wantErr: true,
+		},
+		{
+			name:    "strict units --min without a unit",
+			args:    []string{"--strict-units", "--min", "5", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "decimal comma",
+			args:    []string{"--decimal-comma", "-j", "0%", "1,5s"},
+			wantLow: 1500 * time.Millisecond,
+			wantHi:  1500 * time.Millisecond,
+		},
+		{
+			name:    "decimal comma in a flag",
+			args:    []string{"--decimal-comma", "--min", "0,5s", "--max", "2,5s"},
+			wantLow: 500 * time.Millisecond,
+			wantHi:  2500 * time.Millisecond,
+		},
+		{
+			name:    "comma without --decimal-comma",
+			args:    []string{"1,5s"},
+			wantErr: true,
+		},
+		{
+			name:    "decimal comma with choices",
+			args:    []string{"--decimal-comma", "--choices", "1s,2s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative range",
+			args:    []string{"--range", "-2s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative percent range",
+			args:    []string{"-r", "-10%", "20s"},
+			wantErr: true,
+		},
+		{
+			name:    "exponential default interval",
+			args:    []string{"-d", "exponential", "10s"},
+			wantLow: 0,
+			wantHi:  100 * time.Second,
+		},
+		{
+			name:    "exponential with jitter",
+			args:    []string{"-d", "exponential", "-j", "50%", "10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "exponential with range",
+			args:    []string{"-d", "exponential", "-r", "2s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "exponential with percent range",
+			args:    []string{"-d", "exponential", "--range", "10%", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "exponential with only bounds",
+			args:    []string{"-d", "exponential", "--min", "1s", "--max", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "exponential with only a max",
+			args:    []string{"-d", "exponential", "--max", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "uniform with range",
+			args:    []string{"-d", "uniform", "-r", "2s", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "normal with range",
+			args:    []string{"-d", "normal", "-r", "2s", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "triangular with only bounds",
+			args:    []string{"-d", "triangular", "--min", "1s", "--max", "5s"},
+			wantLow: 1 * time.Second,
+			wantHi:  5 * time.Second,
+		},
+		{
+			name:    "exponential capped by max",
+			args:    []string{"-d", "exponential", "--max", "30s", "10s"},
+			wantLow: 0,
+			wantHi:  30 * time.Second,
+		},
+		{
+			name:    "min clips",
+			args:    []string{"--clamp-mode", "clip", "--min", "9s", "10s"},
+			wantLow: 9 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "min shifts",
+			args:    []string{"--clamp-mode", "shift", "--min", "9s", "10s"},
+			wantLow: 9 * time.Second,
+			wantHi:  19 * time.Second,
+		},
+		{
+			name:    "max shifts",
+			args:    []string{"--clamp-mode", "shift", "--max", "11s", "10s"},
+			wantLow: 1 * time.Second,
+			wantHi:  11 * time.Second,
+		},
+		{
+			name:    "max alone clips",
+			args:    []string{"--max", "11s", "10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  11 * time.Second,
+		},
+		{
+			name:    "unknown clamp mode",
+			args:    []string{"--clamp-mode", "squash", "--min", "9s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "fixed",
+			args:    []string{"--fixed", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "fixed beats jitter",
+			args:    []string{"--fixed", "-j", "50%", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "fixed beats range",
+			args:    []string{"--fixed", "-r", "2s", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "fixed beats positional jitter",
+			args:    []string{"--fixed", "10s", "20%"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "fixed within min and max",
+			args:    []string{"--fixed", "--min", "5s", "--max", "10s", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "fixed moved by min",
+			args:    []string{"--fixed", "--min", "15s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "fixed without base",
+			args:    []string{"--fixed", "--min", "5s", "--max", "15s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative base",
+			args:    []string{"-5s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative sum",
+			args:    []string{"5s", "-10s"},
+			wantErr: true,
+		},
+		{
+			name:    "clamped negative base",
+			args:    []string{"--clamp-negative", "-5s"},
+			wantLow: 0,
+			wantHi:  0,
+		},
+		{
+			name:    "clamped negative base with jitter",
+			args:    []string{"--clamp-negative", "-j", "20%", "-5s"},
+			wantLow: 0,
+			wantHi:  0,
+		},
+		{
+			name:    "negative term in sum",
+			args:    []string{"-v", "-5s", "15s", "20%"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "negative flag value",
+			args:    []string{"--offset", "-2s", "-5s", "10s"},
+			wantLow: 500 * time.Millisecond,
+			wantHi:  5500 * time.Millisecond,
+		},
+		{
+			name:    "offset",
+			args:    []string{"--offset", "5s", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  20 * time.Second,
+		},
+		{
+			name:    "negative offset",
+			args:    []string{"--offset", "-2s", "-j", "20%", "10s"},
+			wantLow: 6 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "offset before min clamp",
+			args:    []string{"--offset", "-10s", "--min", "1s", "10s"},
+			wantLow: 1 * time.Second,
+			wantHi:  5 * time.Second,
+		},
+		{
+			name:    "jitter cap",
+			args:    []string{"-j", "50%", "--jitter-cap", "3s", "1m"},
+			wantLow: 57 * time.Second,
+			wantHi:  63 * time.Second,
+		},
+		{
+			name:    "jitter cap wider than the jitter",
+			args:    []string{"-j", "10%", "--jitter-cap", "1m", "10s"},
+			wantLow: 9 * time.Second,
+			wantHi:  11 * time.Second,
+		},
+		{
+			name:    "jitter cap with range",
+			args:    []string{"--jitter-cap", "3s", "--range", "5s", "1m"},
+			wantErr: true,
+		},
+		{
+			name:    "jitter cap not positive",
+			args:    []string{"--jitter-cap", "0s", "1m"},
+			wantErr: true,
+		},
+		{
+			name:    "plus and minus",
+			args:    []string{"--plus", "5s", "--minus", "2s", "10s"},
+			wantLow: 8 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "minus only",
+			args:    []string{"--minus", "10s", "10s"},
+			wantLow: 0,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "minus more than base",
+			args:    []string{"--minus", "11s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative plus",
+			args:    []string{"--plus", "-1s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "plus with range",
+			args:    []string{"--plus", "1s", "--range", "2s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "plus with positional jitter",
+			args:    []string{"--plus", "1s", "10s", "20%"},
+			wantErr: true,
+		},
+		{
+			name:    "plus without base",
+			args:    []string{"--plus", "1s", "--min", "1s", "--max", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "cap width",
+			args:    []string{"-j", "100%", "--cap-width", "10m", "1h"},
+			wantLow: 55 * time.Minute,
+			wantHi:  65 * time.Minute,
+		},
+		{
+			name:    "cap width then min clamp",
+			args:    []string{"-j", "100%", "--cap-width", "10m", "--min", "1h", "1h"},
+			wantLow: time.Hour,
+			wantHi:  65 * time.Minute,
+		},
+		{
+			name:    "cap width not positive",
+			args:    []string{"--cap-width", "0s", "1h"},
+			wantErr: true,
+		},
+		{
+			name:    "cap width without base",
+			args:    []string{"--cap-width", "1s", "--min", "1s", "--max", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "offset without base",
+			args:    []string{"--offset", "5s", "--min", "1s", "--max", "2s"},
+			wantErr: true,
+		},
+		{
+			name:    "bounds only",
+			args:    []string{"--min", "5s", "--max", "15s"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "zero jitter",
+			args:    []string{"-j", "0%", "10s"},
+			wantLow: 10 * time.Second,
+			wantHi:  10 * time.Second,
+		},
+		{
+			name:    "missing duration",
+			args:    []string{},
+			wantErr: true,
+		},
+		{
+			name:    "jitter and range conflict",
+			args:    []string{"-j", "20%", "-r", "2s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "max less than min",
+			args:    []string{"--min", "10s", "--max", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "positional and flag jitter conflict",
+			args:    []string{"-j", "20%", "10s", "30%"},
+			wantErr: true,
+		},
+		{
+			name:    "range without base",
+			args:    []string{"-r", "2s"},
+			wantErr: true,
+		},
+		{
+			name:    "min/max conflict with base",
+			args:    []string{"--min", "10s", "--max", "5s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "summed durations",
+			args:    []string{"-j", "0%", "1h", "30m"},
+			wantLow: 90 * time.Minute,
+			wantHi:  90 * time.Minute,
+		},
+		{
+			name:    "summed durations with jitter",
+			args:    []string{"1h", "30m", "20%"},
+			wantLow: 72 * time.Minute,
+			wantHi:  108 * time.Minute,
+		},
+		{
+			name:    "summed bare numbers",
+			args:    []string{"10", "20", "0%"},
+			wantLow: 30 * time.Second,
+			wantHi:  30 * time.Second,
+		},
+		{
+			name:    "percent before duration",
+			args:    []string{"1h", "20%", "30m"},
+			wantErr: true,
+		},
+		{
+			name:    "summed overflow",
+			args:    []string{"100000d", "100000d", "100000d"},
+			wantErr: true,
+		},
+		{
+			name:    "positional jitter without base",
+			args:    []string{"--min", "1s", "--max", "5s", "20%"},
+			wantErr: true,
+		},
+		{
+			name:    "jitter past zero",
+			args:    []string{"-j", "200%", "--allow-zero-floor", "10s"},
+			wantLow: 0,
+			wantHi:  30 * time.Second,
+		},
+		{
+			name:    "asymmetric jitter flag",
+			args:    []string{"-j", "-10%+50%", "10s"},
+			wantLow: 9 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "asymmetric positional jitter",
+			args:    []string{"10s", "+50%"},
+			wantLow: 10 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "malformed asymmetric jitter",
+			args:    []string{"-j", "10%20%", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "normal distribution",
+			args:    []string{"--dist", "normal", "10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "infinite count",
+			args:    []string{"--count", "inf", "10s"},
+			wantLow: 5 * time.Second,
+			wantHi:  15 * time.Second,
+		},
+		{
+			name:    "negative count",
+			args:    []string{"--count", "-1", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "backoff without base",
+			args:    []string{"--backoff", "--min", "1s", "--max", "5s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid backoff factor",
+			args:    []string{"--backoff", "--backoff-factor", "0", "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "non-positive max total",
+			args:    []string{"--max-total", "0s", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid stats count",
+			args:    []string{"--stats", "0", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid seed",
+			args:    []string{"--seed", "-1", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown distribution",
+			args:    []string{"--dist", "poisson", "10s"},
+			wantErr: true,
+		},
+		{
+			name:    "flags after positional",
+			args:    []string{"10s", "--jitter", "20%", "-v"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "negative duration after flag",
+			args:    []string{"15s", "-v", "-5s", "20%"},
+			wantLow: 8 * time.Second,
+			wantHi:  12 * time.Second,
+		},
+		{
+			name:    "percent of",
+			args:    []string{"--percent-of", "30s", "10%", "-j", "50%"},
+			wantLow: 1500 * time.Millisecond,
+			wantHi:  4500 * time.Millisecond,
+		},
+		{
+			name:    "percent of with default jitter",
+			args:    []string{"--percent-of", "1m", "50%"},
+			wantLow: 15 * time.Second,
+			wantHi:  45 * time.Second,
+		},
+		{
+			name:    "percent of without percent",
+			args:    []string{"--percent-of", "30s"},
+			wantErr: true,
+		},
+		{
+			name:    "percent of with duration",
+			args:    []string{"--percent-of", "30s", "10s", "10%"},
+			wantErr: true,
+		},
+		{
+			name:    "percent of with until",
+			args:    []string{"--percent-of", "30s", "--until", "09:00", "10%"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if opts.low != tt.wantLow {
+				t.Errorf("parseArgs(%v) low = %v, want %v", tt.args, opts.low, tt.wantLow)
+			}
+			if opts.high != tt.wantHi {
+				t.Errorf("parseArgs(%v) high = %v, want %v", tt.args, opts.high, tt.wantHi)
+			}
+		})
+	}
+}
+
+func TestParseArgsNoClampZero(t *testing.T) {
+	_, err := parseArgs([]string{"-j", "150%", "10s", "--no-clamp-zero"})
+	if err == nil {
+		t.Fatal("parseArgs with an interval below zero succeeded, want error")
+	}
+	for _, bound := range []string{"-5s", "25s"} {
+		if !strings.Contains(err.Error(), bound) {
+			t.Errorf("error %q doesn't show the bound %s", err, bound)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--offset", "-6s", "10s", "--no-clamp-zero"},
+		{"--min", "-1s", "--max", "5s", "--no-clamp-zero"},
+		{"--no-clamp-zero", "--allow-zero-floor", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+
+	opts, err := parseArgs([]string{"--no-clamp-zero", "-j", "100%", "10s"})
+	if err != nil {
+		t.Fatalf("parseArgs with an interval down to zero: %v", err)
+	}
+	if opts.low != 0 || opts.high != 20*time.Second {
+		t.Errorf("parseArgs = [%v, %v], want [0s, 20s]", opts.low, opts.high)
+	}
+}
+
+func TestParseArgsSeed(t *testing.T) {
+	args := []string{"--seed", "7", "10s"}
+	var first time.Duration
+	for i := 0; i < 2; i++ {
+		opts, err := parseArgs(args)
+		if err != nil {
+			t.Fatalf("parseArgs(%v) unexpected error: %v", args, err)
+		}
+		got, err := jitter.ChooseSleepDurationAround(opts.low, opts.high, opts.base, opts.dist, opts.rand)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if i == 0 {
+			first = got
+		} else if got != first {
+			t.Errorf("second run = %v, want %v", got, first)
+		}
+	}
+}
+
+func TestParseArgsRNG(t *testing.T) {
+	tests := []struct {
+		args         []string
+		want         jitter.Source
+		wantWarnings int
+		wantErr      bool
+	}{
+		{args: []string{"10s"}, want: jitter.CryptoSource{}},
+		{args: []string{"--rng", "crypto", "10s"}, want: jitter.CryptoSource{}},
+		{args: []string{"--seed", "7", "10s"}, want: jitter.NewSeededSource(7)},
+		{args: []string{"--rng", "pcg", "--seed", "7", "10s"}, want: jitter.NewPCGSource(7)},
+		{args: []string{"--rng", "math", "10s"}, want: &jitter.SeededSource{}, wantWarnings: 1},
+		{args: []string{"--rng", "pcg", "10s"}, want: &jitter.PCGSource{}, wantWarnings: 1},
+		{args: []string{"--rng", "crypto", "--seed", "7", "10s"}, wantErr: true},
+		{args: []string{"--rng", "bogus", "10s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, "_"), func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgs(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if fmt.Sprintf("%T", opts.rand) != fmt.Sprintf("%T", tt.want) {
+				t.Errorf("parseArgs(%v) rand = %T, want %T", tt.args, opts.rand, tt.want)
+			}
+			if len(opts.warnings) != tt.wantWarnings {
+				t.Errorf("parseArgs(%v) warnings = %q, want %d", tt.args, opts.warnings, tt.wantWarnings)
+			}
+			for i := 0; i < 100; i++ {
+				got, err := jitter.ChooseSleepDurationAround(opts.low, opts.high, opts.base, opts.dist, opts.rand)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got < opts.low || got > opts.high {
+					t.Fatalf("draw %v outside [%v, %v]", got, opts.low, opts.high)
+				}
+			}
+		})
+	}
+}
+
+func TestParseArgsWarmup(t *testing.T) {
+	const k = 5
+	for _, extra := range [][]string{{}, {"--rng", "pcg"}, {"--dist", "normal"}, {"--round", "100ms"}} {
+		base := slices.Concat([]string{"--seed", "7"}, extra, []string{"10s"})
+		t.Run(strings.Join(base, "_"), func(t *testing.T) {
+			opts, err := parseArgs(slices.Concat([]string{"--warmup", fmt.Sprint(k)}, base))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := drawSamples(opts, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if opts, err = parseArgs(base); err != nil {
+				t.Fatal(err)
+			}
+			want, err := drawSamples(opts, k+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got[0] != want[k] {
+				t.Errorf("first draw after --warmup %d = %v, want draw %d without it, %v", k, got[0], k+1, want[k])
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"--warmup", "3", "10s"}, {"--seed", "7", "--warmup", "-1", "10s"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunAt(t *testing.T) {
+	tests := []struct {
+		args []string
+		want time.Duration
+	}{
+		{[]string{"--at", "0%", "10s"}, 5 * time.Second},
+		{[]string{"--at", "100%", "10s"}, 15 * time.Second},
+		{[]string{"--at", "50%", "--min", "2s", "--max", "4s"}, 3 * time.Second},
+		{[]string{"--at", "50%", "--dist", "normal", "10s"}, 10 * time.Second},
+		{[]string{"--at", "25%", "-j", "20%", "10s"}, 9 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := drawSamples(opts, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range got {
+				if d != tt.want {
+					t.Errorf("sample = %v, want %v", d, tt.want)
+				}
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"--at", "150%", "10s"}, {"--at", "half", "10s"}, {"--at", "-5%", "10s"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunDumpArgs(t *testing.T) {
+	t.Setenv("JSLEEP_JITTER", "")
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			[]string{"--dump-args", "-j", "20%", "--min", "9s", "--dist", "normal", "10s", "--", "true"},
+			[]string{"base=10s", "jitter_source=--jitter", "jitter_down=20%", "jitter_up=20%", "unclamped_low=8s",
+				"unclamped_high=12s", "min=9s", "max=none", "clamp_mode=clip", "low=9s", "high=12s", "dist=normal", "rng=crypto"},
+		},
+		{
+			[]string{"--dump-args", "--seed", "3", "-r", "2s", "10s"},
+			[]string{"jitter_source=--range", "range=2s", "low=8s", "high=12s", "rng=math"},
+		},
+		{
+			[]string{"--dump-args", "10s", "-10%+50%"},
+			[]string{"jitter_source=positional", "jitter_down=10%", "jitter_up=50%", "low=9s", "high=15s"},
+		},
+		{
+			[]string{"--dump-args", "--min", "2s", "--max", "4s"},
+			[]string{"base=3s", "jitter_source=--min/--max", "low=2s", "high=4s"},
+		},
+		{
+			[]string{"--dump-args", "--fixed", "10s"},
+			[]string{"jitter_source=--fixed", "low=10s", "high=10s"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(tt.args, &stdout, &stderr); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(stdout.String(), "\n")
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("dump is missing %q:\n%s", want, stdout.String())
+				}
+			}
+			if stderr.Len() != 0 {
+				t.Errorf("unexpected stderr: %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestParseArgsNegativeRange(t *testing.T) {
+	for _, args := range [][]string{{"--range", "-2s", "10s"}, {"--range=-2s", "10s"}} {
+		_, err := parseArgs(args)
+		if err == nil || !strings.Contains(err.Error(), "cannot be negative") || !strings.Contains(err.Error(), "--range 2s") {
+			t.Errorf("parseArgs(%v) error = %v, want one suggesting --range 2s", args, err)
+		}
+	}
+}
+
+func TestParseArgsSeedEnv(t *testing.T) {
+	if envSeed("run-1") != envSeed("run-1") {
+		t.Error("envSeed is not stable for the same value")
+	}
+	if envSeed("run-1") == envSeed("run-2") {
+		t.Error("envSeed gave run-1 and run-2 the same seed")
+	}
+
+	draw := func(value string) time.Duration {
+		t.Helper()
+		t.Setenv("JSLEEP_TEST_RUN_ID", value)
+		opts, err := parseArgs([]string{"--seed-env", "JSLEEP_TEST_RUN_ID", "--warmup", "3", "10s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples, err := drawSamples(opts, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return samples[0]
+	}
+	if a, b := draw("run-1"), draw("run-1"); a != b {
+		t.Errorf("same --seed-env value picked %s then %s", a, b)
+	}
+	if a, b := draw("run-1"), draw("run-2"); a == b {
+		t.Errorf("different --seed-env values both picked %s", a)
+	}
+
+	t.Setenv("JSLEEP_TEST_RUN_ID", "")
+	t.Setenv("JSLEEP_TEST_OTHER", "run-1")
+	for _, args := range [][]string{
+		{"--seed-env", "JSLEEP_TEST_RUN_ID", "10s"},
+		{"--seed-env", "JSLEEP_TEST_OTHER", "--seed", "1", "10s"},
+		{"--seed-env", "JSLEEP_TEST_OTHER", "--rng", "crypto", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestParseArgsRNGRetries(t *testing.T) {
+	opts, err := parseArgs([]string{"--rng-retries", "5", "10s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (jitter.CryptoSource{Retries: 5}); opts.rand != want {
+		t.Errorf("rand = %#v, want %#v", opts.rand, want)
+	}
+
+	for _, args := range [][]string{
+		{"--rng-retries", "0", "10s"},
+		{"--rng-retries", "many", "10s"},
+		{"--rng", "pcg", "--rng-retries", "5", "10s"},
+		{"--rng", "pcg", "--rng-retries", "1000", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunEntropyFile(t *testing.T) {
+	// Two draws' worth: 7ms and 2s, as offsets into [0s, 10s].
+	entropy := binary.LittleEndian.AppendUint64(nil, uint64(7*time.Millisecond))
+	entropy = binary.LittleEndian.AppendUint64(entropy, uint64(2*time.Second))
+	path := filepath.Join(t.TempDir(), "entropy")
+	if err := os.WriteFile(path, entropy, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"sample", "--entropy-file", path, "--min", "0s", "--max", "10s", "-n", "2"}, &stdout, new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stdout.String(), "7ms\n2s\n"; got != want {
+		t.Errorf("samples = %q, want %q", got, want)
+	}
+
+	err := run([]string{"sample", "--entropy-file", path, "--min", "0s", "--max", "10s", "-n", "3"}, new(bytes.Buffer), new(bytes.Buffer))
+	if exitCode(err) != exitRandomness || !strings.Contains(err.Error(), "ran out of bytes") {
+		t.Errorf("third draw from two draws' worth: error = %v, want randomness running out", err)
+	}
+
+	for _, args := range [][]string{
+		{"--entropy-file", filepath.Join(t.TempDir(), "missing"), "10s"},
+		{"--rng", "pcg", "--entropy-file", path, "10s"},
+		{"--seed", "1", "--entropy-file", path, "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestParseArgsCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantCommand []string
+		wantVerbose bool
+	}{
+		{
+			name: "no command",
+			args: []string{"10s"},
+		},
+		{
+			name:        "simple command",
+			args:        []string{"10s", "--", "echo", "hi"},
+			wantCommand: []string{"echo", "hi"},
+		},
+		{
+			name:        "flag-like command arguments",
+			args:        []string{"10s", "--", "ls", "-v", "--jitter", "20%"},
+			wantCommand: []string{"ls", "-v", "--jitter", "20%"},
+		},
+		{
+			name:        "nested separator",
+			args:        []string{"-v", "10s", "--", "env", "--", "-x"},
+			wantCommand: []string{"env", "--", "-x"},
+			wantVerbose: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := parseArgs(tt.args)
+			if err != nil {
+				t.Fatalf("parseArgs(%v) unexpected error: %v", tt.args, err)
+			}
+			if !slices.Equal(opts.command, tt.wantCommand) {
+				t.Errorf("parseArgs(%v) command = %q, want %q", tt.args, opts.command, tt.wantCommand)
+			}
+			if (opts.verbose > 0) != tt.wantVerbose {
+				t.Errorf("parseArgs(%v) verbose = %v, want %v", tt.args, opts.verbose, tt.wantVerbose)
+			}
+		})
+	}
+}
+
+func TestParseArgsInvariants(t *testing.T) {
+	validArgSets := [][]string{
+		{"10s"},
+		{"10s", "25%"},
+		{"-j", "30%", "5s"},
+		{"-r", "1s", "10s"},
+		{"--min", "1s", "--max", "10s"},
+		{"--min", "5s", "10s"},
+		{"--max", "15s", "10s"},
+		{"--min", "8s", "--max", "12s", "10s"},
+	}
+
+	for _, args := range validArgSets {
+		t.Run(strings.Join(args, "_"), func(t *testing.T) {
+			opts, err := parseArgs(args)
+			if err != nil {
+				t.Errorf("parseArgs(%v) unexpected error: %v", args, err)
+				return
+			}
+			low, high := opts.low, opts.high
+			if low > high {
+				t.Errorf("parseArgs(%v) low=%v > high=%v", args, low, high)
+			}
+			if low < 0 {
+				t.Errorf("parseArgs(%v) low=%v < 0", args, low)
+			}
+			if high < 0 {
+				t.Errorf("parseArgs(%v) high=%v < 0", args, high)
+			}
+		})
+	}
+}
+
+func TestRunSkipIfCI(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		args      []string
+		wantSleep bool
+	}{
+		{"CI set", map[string]string{"CI": "true"}, nil, false},
+		{"GITHUB_ACTIONS set", map[string]string{"GITHUB_ACTIONS": "true"}, nil, false},
+		{"off CI", nil, nil, true},
+		{"CI turned off", map[string]string{"CI": "false"}, nil, true},
+		{"other variable", map[string]string{"CI": "true"}, []string{"--ci-env", "BUILDKITE"}, true},
+		{"custom variable", map[string]string{"BUILDKITE": "1"}, []string{"--ci-env", "JENKINS_URL, BUILDKITE"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"CI", "GITHUB_ACTIONS", "BUILDKITE", "JENKINS_URL"} {
+				t.Setenv(name, tt.env[name])
+			}
+			args := slices.Concat([]string{"--skip-if-ci", "-j", "0%"}, tt.args, []string{"50ms"})
+			var stderr bytes.Buffer
+			start := time.Now()
+			if err := run(args, new(bytes.Buffer), &stderr); err != nil {
+				t.Fatalf("run(%v): %v", args, err)
+			}
+			if slept := time.Since(start) >= 50*time.Millisecond; slept != tt.wantSleep {
+				t.Errorf("run(%v) slept = %v, want %v", args, slept, tt.wantSleep)
+			}
+			if printed := strings.HasPrefix(stderr.String(), "sleeping for 50ms"); printed == tt.wantSleep {
+				t.Errorf("run(%v) stderr = %q; want the duration printed only when skipping", args, stderr.String())
+			}
+		})
+	}
+
+	t.Run("keeps the command", func(t *testing.T) {
+		t.Setenv("CI", "true")
+		opts, err := parseArgs([]string{"--skip-if-ci", "10s", "--", "true"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !opts.dryRun || opts.ciVar != "CI" || len(opts.command) != 1 {
+			t.Errorf("dryRun = %v, ciVar = %q, command = %q; want a dry run because of CI that keeps the command", opts.dryRun, opts.ciVar, opts.command)
+		}
+	})
+
+	for _, env := range []string{"CI", "CI,GITHUB_ACTIONS"} {
+		if _, err := parseArgs([]string{"--ci-env", env, "10s"}); err == nil {
+			t.Errorf("--ci-env %s without --skip-if-ci succeeded, want error", env)
+		}
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	t.Run("verbose line", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		start := time.Now()
+		if err := run([]string{"--dry-run", "10s"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("dry run took %v, want no sleep", elapsed)
+		}
+		if !strings.HasPrefix(stderr.String(), "sleeping for ") {
+			t.Errorf("stderr = %q, want the chosen duration", stderr.String())
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("stdout = %q, want empty", stdout.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		start := time.Now()
+		if err := run([]string{"-n", "--json", "10s"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("dry run took %v, want no sleep", elapsed)
+		}
+		var got sleepReport
+		if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+			t.Fatalf("unmarshal %q: %v", stdout.String(), err)
+		}
+		if got.ChosenNs < got.LowNs || got.ChosenNs > got.HighNs {
+			t.Errorf("chosen_ns = %d, want in [%d, %d]", got.ChosenNs, got.LowNs, got.HighNs)
+		}
+	})
+
+	t.Run("skips command", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if err := run([]string{"-n", "10s", "--", "jsleep-no-such-command"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+	})
+}
+
+func TestRunExplain(t *testing.T) {
+	echo, err := exec.LookPath("echo")
+	if err != nil {
+		t.Skip("no echo in $PATH")
+	}
+	echo, err = filepath.Abs(echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"--explain", "10s", "--", "echo", "hi there"}, &stdout, new(bytes.Buffer)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := "path=" + echo + "\nargv=\"echo\" \"hi there\"\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("--explain printed %q, want %q", got, want)
+	}
+
+	for _, args := range [][]string{{"--explain", "10s"}, {"--explain", "10s", "--", "jsleep-no-such-command"}} {
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); err == nil {
+			t.Errorf("run(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestSleep(t *testing.T) {
+	t.Run("timer fires", func(t *testing.T) {
+		if !sleep(time.Millisecond, time.Now(), make(chan os.Signal), nil) {
+			t.Error("sleep reported interruption without a signal")
+		}
+	})
+
+	t.Run("nil channel", func(t *testing.T) {
+		if !sleep(time.Millisecond, time.Now(), nil, nil) {
+			t.Error("sleep reported interruption without a signal channel")
+		}
+	})
+
+	t.Run("signal before timer", func(t *testing.T) {
+		interrupt := make(chan os.Signal, 1)
+		interrupt <- os.Interrupt
+
+		start := time.Now()
+		if sleep(time.Hour, time.Now(), interrupt, nil) {
+			t.Error("sleep completed despite a pending signal")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("interrupted sleep took %v", elapsed)
+		}
+	})
+
+	t.Run("countdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !sleep(10*time.Millisecond, time.Now(), nil, &buf) {
+			t.Fatal("sleep reported interruption without a signal")
+		}
+		want := "\rsleeping 0s remaining...\033[K\r\033[K"
+		if got := buf.String(); got != want {
+			t.Errorf("countdown output = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestSleepResume(t *testing.T) {
+	t.Run("remaining", func(t *testing.T) {
+		start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		deadline := start.Add(10 * time.Second)
+		for _, tt := range []struct {
+			suspended time.Duration
+			want      time.Duration
+		}{
+			{0, 10 * time.Second},
+			{7 * time.Second, 3 * time.Second},
+			{10 * time.Second, 0},
+			{time.Hour, 0},
+		} {
+			if got := remaining(deadline, start.Add(tt.suspended)); got != tt.want {
+				t.Errorf("remaining after %s suspended = %s, want %s", tt.suspended, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("continued", func(t *testing.T) {
+		orig := notifyContinue
+		t.Cleanup(func() { notifyContinue = orig })
+		resumed := make(chan os.Signal, 1)
+		notifyContinue = func() (<-chan os.Signal, func()) {
+			resumed <- os.Interrupt
+			return resumed, func() {}
+		}
+
+		// Resetting the timer on resume must not restart the whole sleep.
+		const d = 50 * time.Millisecond
+		start := time.Now()
+		if !sleep(d, time.Now(), nil, nil) {
+			t.Fatal("sleep reported interruption without a signal")
+		}
+		if elapsed := time.Since(start); elapsed < d || elapsed > time.Second {
+			t.Errorf("resumed sleep of %s took %v", d, elapsed)
+		}
+	})
+
+	t.Run("wall clock jump", func(t *testing.T) {
+		orig, origNow := notifyContinue, now
+		t.Cleanup(func() { notifyContinue, now = orig, origNow })
+		notifyContinue = func() (<-chan os.Signal, func()) {
+			resumed := make(chan os.Signal, 1)
+			resumed <- os.Interrupt
+			return resumed, func() {}
+		}
+		// The wall clock reads two hours later than when the sleep began.
+		now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+		const d = 50 * time.Millisecond
+		for _, tt := range []struct {
+			name      string
+			monotonic bool
+			short     bool
+		}{
+			{"catches up to the wall clock", false, true},
+			{"monotonic only", true, false},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				wall := sleepWall(time.Now(), options{monotonic: tt.monotonic})
+				start := time.Now()
+				if !sleep(d, wall, nil, nil) {
+					t.Fatal("sleep reported interruption without a signal")
+				}
+				if elapsed := time.Since(start); (elapsed < d) != tt.short {
+					t.Errorf("sleep of %s took %v, want short = %t", d, elapsed, tt.short)
+				}
+			})
+		}
+	})
+}
+
+func TestSpin(t *testing.T) {
+	const target = 500 * time.Microsecond
+	start := time.Now()
+	spin(target)
+	elapsed := time.Since(start)
+	// The upper bound only catches a spin that never stops; a busy machine
+	// can deschedule the loop for far longer than the target.
+	if elapsed < target || elapsed > target+50*time.Millisecond {
+		t.Errorf("spin(%s) took %s", target, elapsed)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"--spin", "-j", "0%", "500us"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
+
+func TestRunSleep(t *testing.T) {
+	// Each reading of the fake clock is 8.24s after the last, so the
+	// measurement is independent of how long the real sleep takes.
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		clock = clock.Add(8240 * time.Millisecond)
+		return clock
+	}
+	t.Cleanup(func() { now = time.Now })
+
+	for _, spinning := range []bool{false, true} {
+		elapsed, ok := runSleep(time.Millisecond, options{spin: spinning}, nil, nil)
+		if !ok {
+			t.Fatalf("runSleep(spin=%v) reported an interrupt", spinning)
+		}
+		if elapsed != 8240*time.Millisecond {
+			t.Errorf("runSleep(spin=%v) elapsed = %s, want 8.24s", spinning, elapsed)
+		}
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	interrupt <- os.Interrupt
+	if _, ok := runSleep(time.Hour, options{}, interrupt, nil); ok {
+		t.Error("runSleep ignored an interrupt")
+	}
+}
+
+func TestParseArgsVerboseLevel(t *testing.T) {
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"10s"}, 0},
+		{[]string{"-v", "10s"}, 1},
+		{[]string{"--verbose", "10s"}, 1},
+		{[]string{"-vv", "10s"}, 2},
+		{[]string{"-v", "10s", "-v"}, 2},
+		{[]string{"-vvv", "10s"}, 3},
+		{[]string{"--verbose=3", "10s"}, 3},
+		{[]string{"-vv", "--verbose=false", "10s"}, 0},
+		{[]string{"--format", "-vv", "10s"}, 0},
+	} {
+		opts, err := parseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("parseArgs(%v): %v", tt.args, err)
+		}
+		if opts.verbose != tt.want {
+			t.Errorf("parseArgs(%v) verbose = %d, want %d", tt.args, opts.verbose, tt.want)
+		}
+	}
+}
+
+func TestRunVerboseLevels(t *testing.T) {
+	for _, tt := range []struct {
+		flag          string
+		want, exclude []string
+	}{
+		{"-v", []string{"sleeping for", "chosen="}, []string{"interval", "dist", "rng", "values"}},
+		{"-vv", []string{"sleeping for", "interval [", "dist triangular"}, []string{"rng", "values"}},
+		{"-vvv", []string{"sleeping for", "interval [", "dist triangular", "rng pcg values ", " attempts "}, nil},
+	} {
+		var stderr bytes.Buffer
+		if err := run([]string{tt.flag, "--rng", "pcg", "--seed", "1", "--dist", "triangular", "-j", "50%", "2ms"}, new(bytes.Buffer), &stderr); err != nil {
+			t.Fatalf("run %s: %v", tt.flag, err)
+		}
+		out := stderr.String()
+		for _, s := range tt.want {
+			if !strings.Contains(out, s) {
+				t.Errorf("%s output %q is missing %q", tt.flag, out, s)
+			}
+		}
+		for _, s := range tt.exclude {
+			if strings.Contains(out, s) {
+				t.Errorf("%s output %q includes %q", tt.flag, out, s)
+			}
+		}
+	}
+}
+
+// TestRunVerboseAttempts feeds -vvv entropy whose first draw is past the
+// rejection limit for [0, 2ns], so the one value takes two attempts.
+func TestRunVerboseAttempts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entropy")
+	entropy := append(bytes.Repeat([]byte{0xff}, 8), binary.LittleEndian.AppendUint64(nil, 7)...)
+	if err := os.WriteFile(path, entropy, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var stderr bytes.Buffer
+	if err := run([]string{"-vvv", "--entropy-file", path, "--min", "0s", "--max", "2ns"}, new(bytes.Buffer), &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := "rng crypto values 1 attempts 2\n"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("-vvv output %q is missing %q", stderr.String(), want)
+	}
+}
+
+func TestRunVerboseActual(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-v", "-j", "0%", "5ms"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != 2 || lines[0] != "sleeping for 5ms" || !strings.HasPrefix(lines[1], "chosen=5ms actual=") {
+		t.Errorf("verbose output = %q, want the chosen line then chosen= actual=", stderr.String())
+	}
+
+	stderr.Reset()
+	if err := run([]string{"-n", "-j", "0%", "5ms"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if strings.Contains(stderr.String(), "actual=") {
+		t.Errorf("dry run reported an actual sleep: %q", stderr.String())
+	}
+}
+
+func TestRenderCountdown(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{12300 * time.Millisecond, "\rsleeping 12.3s remaining...\033[K"},
+		{12345 * time.Millisecond, "\rsleeping 12.3s remaining...\033[K"},
+		{90 * time.Minute, "\rsleeping 1h30m0s remaining...\033[K"},
+		{40 * time.Millisecond, "\rsleeping 0s remaining...\033[K"},
+		{-time.Second, "\rsleeping 0s remaining...\033[K"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remaining.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			renderCountdown(&buf, tt.remaining)
+			if got := buf.String(); got != tt.want {
+				t.Errorf("renderCountdown(%v) = %q, want %q", tt.remaining, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCount(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"--count", "3", "--json", "-v", "10ms"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if strings.HasPrefix(line, "sleeping for ") {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d verbose lines, want 3: %q", len(lines), stderr.String())
+	}
+	for i, line := range lines {
+		if want := fmt.Sprintf("(iteration %d of 3)", i+1); !strings.HasSuffix(line, want) {
+			t.Errorf("line %d = %q, want suffix %q", i, line, want)
+		}
+	}
+
+	dec := json.NewDecoder(&stdout)
+	seen := make(map[int64]bool)
+	for i := 0; i < 3; i++ {
+		var got sleepReport
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("decode report %d: %v", i, err)
+		}
+		seen[got.ChosenNs] = true
+	}
+	if len(seen) == 1 {
+		t.Errorf("all three iterations chose the same duration; want independent draws")
+	}
+}
+
+func TestRunFormat(t *testing.T) {
+	ref := time.Unix(1700000000, 0)
+	now = func() time.Time { return ref }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"sleeping for {{.Chosen}}", "sleeping for 10s\n"},
+		{"{{.Low}} {{.High}} {{.Chosen}} {{.Unix}}", "10s 10s 10s 1700000000\n"},
+		{"chosen_ms={{.Chosen.Milliseconds}}\n", "chosen_ms=10000\n"},
+	}
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		args := []string{"-n", "--fixed", "--format", tt.format, "10s"}
+		if err := run(args, new(bytes.Buffer), &stderr); err != nil {
+			t.Fatalf("run(%v): %v", args, err)
+		}
+		if got := stderr.String(); got != tt.want {
+			t.Errorf("--format %q printed %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	t.Run("bounds", func(t *testing.T) {
+		var stderr bytes.Buffer
+		if err := run([]string{"-v", "--format", "[{{.Low}}, {{.High}}]", "-j", "20%", "1ms"}, new(bytes.Buffer), &stderr); err != nil {
+			t.Fatal(err)
+		}
+		if got, _, _ := strings.Cut(stderr.String(), "\n"); got != "[800µs, 1.2ms]" {
+			t.Errorf("got %q, want the interval", got)
+		}
+	})
+
+	for _, format := range []string{"{{.Chosen", "{{.Nope}}"} {
+		if _, err := parseArgs([]string{"--format", format, "10s"}); err == nil {
+			t.Errorf("parseArgs(--format %q) succeeded, want error", format)
+		}
+	}
+}
+
+func TestRoundDuration(t *testing.T) {
+	d := 8231 * time.Millisecond
+	tests := []struct {
+		mode string
+		unit time.Duration
+		want time.Duration
+	}{
+		{"round", time.Second, 8 * time.Second},
+		{"floor", time.Second, 8 * time.Second},
+		{"ceil", time.Second, 9 * time.Second},
+		{"round", 100 * time.Millisecond, 8200 * time.Millisecond},
+		{"ceil", 100 * time.Millisecond, 8300 * time.Millisecond},
+		{"ceil", time.Millisecond, d},
+	}
+
+	for _, tt := range tests {
+		if got := roundDuration(d, tt.unit, tt.mode); got != tt.want {
+			t.Errorf("roundDuration(%s, %s, %q) = %s, want %s", d, tt.unit, tt.mode, got, tt.want)
+		}
+	}
+
+	if got := roundDuration(math.MaxInt64, time.Hour, "ceil"); got <= 0 {
+		t.Errorf("ceil near MaxInt64 overflowed to %s", got)
+	}
+}
+
+func TestQuantizeDuration(t *testing.T) {
+	d := 8231 * time.Millisecond
+	step := 250 * time.Millisecond
+	tests := []struct {
+		name      string
+		low, high time.Duration
+		want      time.Duration
+		wantOK    bool
+	}{
+		{"nearest", 5 * time.Second, 15 * time.Second, 8250 * time.Millisecond, true},
+		{"high edge", 5 * time.Second, 8240 * time.Millisecond, 8 * time.Second, true},
+		{"low edge", 8230 * time.Millisecond, 9 * time.Second, 8250 * time.Millisecond, true},
+		{"exact edge", 8 * time.Second, 8250 * time.Millisecond, 8250 * time.Millisecond, true},
+		{"no multiple inside", 8010 * time.Millisecond, 8240 * time.Millisecond, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := quantizeDuration(d, step, tt.low, tt.high)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("quantizeDuration(%s, %s, %s, %s) = %s, %v; want %s, %v", d, step, tt.low, tt.high, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRunRounding(t *testing.T) {
+	t.Run("whole seconds", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if err := run([]string{"--stats", "201", "--round", "1s", "10s"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		for key, d := range parseStats(t, stdout.String()) {
+			if key != "mean" && d%time.Second != 0 {
+				t.Errorf("%s=%s is not a whole second", key, d)
+			}
+		}
+	})
+
+	t.Run("crosses max", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := run([]string{"-n", "--ceil", "1s", "--max", "8500ms", "--min", "8100ms"}, &stdout, &stderr)
+		if err == nil {
+			t.Error("expected an error when rounding crosses --max")
+		}
+	})
+
+	t.Run("quantize stays in range", func(t *testing.T) {
+		var stdout bytes.Buffer
+		if err := run([]string{"sample", "-n", "200", "--quantize", "250ms", "--min", "8010ms", "--max", "8990ms"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		for line := range strings.FieldsSeq(stdout.String()) {
+			if d, _ := time.ParseDuration(line); d%(250*time.Millisecond) != 0 || d < 8010*time.Millisecond || d > 8990*time.Millisecond {
+				t.Errorf("sample %s is off the 250ms grid or outside [8.01s, 8.99s]", line)
+			}
+		}
+	})
+
+	t.Run("quantize without a multiple in range", func(t *testing.T) {
+		err := run([]string{"-n", "--quantize", "1s", "--min", "8100ms", "--max", "8900ms"}, new(bytes.Buffer), new(bytes.Buffer))
+		if err == nil {
+			t.Error("expected an error when no multiple of the step is in range")
+		}
+	})
+
+	for _, args := range [][]string{
+		{"--round", "1s", "--floor", "1s", "10s"},
+		{"--round", "1s", "--quantize", "250ms", "10s"},
+		{"--quantize", "0s", "10s"},
+		{"--ceil", "0s", "10s"},
+		{"--floor", "bogus", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestBackoffBase(t *testing.T) {
+	limit := 30 * time.Second
+	tests := []struct {
+		name   string
+		factor float64
+		limit  *time.Duration
+		want   []time.Duration
+	}{
+		{
+			name:   "doubling",
+			factor: 2,
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 32 * time.Second},
+		},
+		{
+			name:   "capped",
+			factor: 2,
+			limit:  &limit,
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second},
+		},
+		{
+			name:   "fractional factor",
+			factor: 1.5,
+			want:   []time.Duration{time.Second, 1500 * time.Millisecond, 2250 * time.Millisecond},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for step, want := range tt.want {
+				if got := backoffBase(time.Second, tt.factor, step, tt.limit); got != want {
+					t.Errorf("step %d: got %v, want %v", step, got, want)
+				}
+			}
+		})
+	}
+
+	t.Run("saturates", func(t *testing.T) {
+		if got := backoffBase(time.Hour, 2, 1000, nil); got != math.MaxInt64 {
+			t.Errorf("got %v, want saturation at MaxInt64", got)
+		}
+	})
+}
+
+func TestRunBackoff(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	args := []string{"-n", "--json", "--backoff", "--count", "5", "--max", "5s", "-j", "10%", "1s"}
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	wantMid := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	dec := json.NewDecoder(&stdout)
+	for i, mid := range wantMid {
+		var got sleepReport
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("decode report %d: %v", i, err)
+		}
+		low, high := time.Duration(got.LowNs), time.Duration(got.HighNs)
+		wantLow, wantHigh := mid-mid/10, min(mid+mid/10, 5*time.Second)
+		if low != wantLow || high != wantHigh {
+			t.Errorf("iteration %d: bounds = [%v, %v], want [%v, %v]", i+1, low, high, wantLow, wantHigh)
+		}
+	}
+}
+
+func TestParseArgsMaxBelowBase(t *testing.T) {
+	opts, err := parseArgs([]string{"--max", "5s", "10s"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if len(opts.warnings) != 1 || !strings.Contains(opts.warnings[0], "--max 5s is below the base duration 10s") {
+		t.Errorf("warnings = %q, want one about --max below the base", opts.warnings)
+	}
+	if opts.low != 5*time.Second || opts.high != 5*time.Second {
+		t.Errorf("interval = [%s, %s], want the lenient clamp to [5s, 5s]", opts.low, opts.high)
+	}
+
+	if _, err := parseArgs([]string{"--strict", "--max", "5s", "10s"}); err == nil || !strings.Contains(err.Error(), "unit mistake") {
+		t.Errorf("parseArgs with --strict = %v, want a unit mistake error", err)
+	}
+	if _, err := parseArgs([]string{"--strict", "--max", "12s", "10s"}); err != nil {
+		t.Errorf("parseArgs with --strict and --max above the base: %v", err)
+	}
+}
+
+func TestRunZeroFloorWarning(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"verbose", []string{"-n", "--count", "3", "-j", "200%", "10s"}, 1},
+		{"allowed", []string{"-n", "--count", "3", "-j", "200%", "--allow-zero-floor", "10s"}, 0},
+		{"not verbose", []string{"-j", "200%", "1ms"}, 0},
+		{"within base", []string{"-n", "-j", "100%", "10s"}, 0},
+		{"range past zero", []string{"-n", "-r", "20s", "10s"}, 1},
+		{"min collapses interval", []string{"-n", "--min", "20s", "10s"}, 1},
+		{"max nearly collapses interval", []string{"-n", "--max", "5001ms", "10s"}, 1},
+		{"no jitter to collapse", []string{"-n", "-j", "0%", "--min", "20s", "10s"}, 0},
+		{"min leaves jitter", []string{"-n", "--min", "8s", "10s"}, 0},
+		{"max below base", []string{"-n", "--max", "5s", "10s"}, 1},
+		{"max above base", []string{"-n", "--max", "12s", "10s"}, 0},
+		{"collapse quiet", []string{"-n", "-q", "--min", "20s", "10s"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(tt.args, &stdout, &stderr); err != nil {
+				t.Fatalf("run(%v): %v", tt.args, err)
+			}
+			if got := strings.Count(stderr.String(), "jsleep: warning:"); got != tt.want {
+				t.Errorf("run(%v) printed %d warnings, want %d:\n%s", tt.args, got, tt.want, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunSample(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    int
+		wantErr bool
+	}{
+		{"count after duration", []string{"sample", "10s", "-n", "5"}, 5, false},
+		{"count first", []string{"sample", "-n", "5", "10s"}, 5, false},
+		{"count with equals", []string{"sample", "-n=3", "-j", "20%", "10s"}, 3, false},
+		{"default count", []string{"sample", "10s"}, 1, false},
+		{"min and max", []string{"sample", "--min", "5s", "--max", "15s", "-n", "4"}, 4, false},
+		{"bad count", []string{"sample", "10s", "-n", "zero"}, 0, true},
+		{"missing count", []string{"sample", "10s", "-n"}, 0, true},
+		{"command", []string{"sample", "10s", "--", "true"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(tt.args, &stdout, &stderr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+			if len(lines) != tt.want {
+				t.Fatalf("got %d lines, want %d: %q", len(lines), tt.want, stdout.String())
+			}
+			for _, line := range lines {
+				d, err := time.ParseDuration(line)
+				if err != nil {
+					t.Fatalf("unparseable sample %q: %v", line, err)
+				}
+				if d < 5*time.Second || d > 15*time.Second {
+					t.Errorf("sample %s outside [5s, 15s]", d)
+				}
+			}
+			if stderr.Len() != 0 {
+				t.Errorf("unexpected stderr: %q", stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunClampReport(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"clamped", []string{"--clamp-report", "-j", "80%", "--min", "5s", "--max", "12s", "-n", "10s"}, "jsleep: clamped [2s, 18s] to [5s, 12s]\n"},
+		{"without dry run", []string{"--clamp-report", "-j", "0%", "--max", "1ms", "1s"}, "jsleep: clamped [1s, 1s] to [1ms, 1ms]\n"},
+		{"zero floor", []string{"--clamp-report", "-j", "200%", "--allow-zero-floor", "--stats", "1", "10s"}, "jsleep: clamped [-10s, 30s] to [0s, 30s]\n"},
+		{"unchanged", []string{"--clamp-report", "-j", "20%", "--min", "5s", "--max", "12s", "--stats", "1", "10s"}, ""},
+		{"not requested", []string{"-j", "80%", "--min", "5s", "--max", "12s", "--stats", "1", "10s"}, ""},
+		{"quiet", []string{"-q", "--clamp-report", "-j", "80%", "--min", "5s", "--stats", "1", "10s"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(tt.args, &stdout, &stderr); err != nil {
+				t.Fatalf("run(%v): %v", tt.args, err)
+			}
+			var got string
+			for _, line := range strings.SplitAfter(stderr.String(), "\n") {
+				if strings.HasPrefix(line, "jsleep: clamped") {
+					got += line
+				}
+			}
+			if got != tt.want {
+				t.Errorf("run(%v) clamp report = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunWarnAbove(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantErr     bool
+		wantWarning bool
+	}{
+		{"strict", []string{"--warn-above", "10m", "--strict", "-j", "0%", "1h"}, true, false},
+		{"warning", []string{"--warn-above", "10m", "-n", "-j", "0%", "1h"}, false, true},
+		{"under threshold", []string{"--warn-above", "10m", "--strict", "-n", "-j", "0%", "5m"}, false, false},
+		{"quiet", []string{"-q", "--warn-above", "10m", "-n", "-j", "0%", "1h"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(tt.args, &stdout, &stderr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if got := strings.Contains(stderr.String(), "warning: chosen sleep 1h0m0s is above --warn-above 10m0s"); got != tt.wantWarning {
+				t.Errorf("run(%v) warned = %v, want %v: %q", tt.args, got, tt.wantWarning, stderr.String())
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"--strict", "10s"},
+		{"--warn-above", "0s", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunDistFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "latencies")
+	if err := os.WriteFile(path, []byte("# measured\n1s\n\n2s\n3s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	draw := func(t *testing.T, args ...string) []time.Duration {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		args = append([]string{"sample", "-n", "300", "--dist-file", path}, args...)
+		if err := run(args, &stdout, &stderr); err != nil {
+			t.Fatalf("run(%v): %v", args, err)
+		}
+		var ds []time.Duration
+		for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+			d, err := time.ParseDuration(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ds = append(ds, d)
+		}
+		return ds
+	}
+
+	t.Run("exact values", func(t *testing.T) {
+		seen := make(map[time.Duration]int)
+		for _, d := range draw(t) {
+			seen[d]++
+		}
+		if len(seen) != 3 || seen[time.Second] == 0 || seen[2*time.Second] == 0 || seen[3*time.Second] == 0 {
+			t.Errorf("drew %v, want only and all of 1s, 2s, 3s", seen)
+		}
+	})
+
+	t.Run("jittered", func(t *testing.T) {
+		for _, d := range draw(t, "-j", "10%") {
+			near := false
+			for _, v := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+				near = near || (d >= v-v/10 && d <= v+v/10)
+			}
+			if !near {
+				t.Fatalf("draw %v isn't within 10%% of 1s, 2s, or 3s", d)
+			}
+		}
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--dist-file", path, "-r", "500ms"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.low != 500*time.Millisecond || opts.high != 3500*time.Millisecond {
+			t.Errorf("bounds = [%v, %v], want [500ms, 3.5s]", opts.low, opts.high)
+		}
+	})
+
+	bad := filepath.Join(t.TempDir(), "bad")
+	if err := os.WriteFile(bad, []byte("1s\nsoon\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(t.TempDir(), "empty")
+	if err := os.WriteFile(empty, []byte("# nothing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"--dist-file", path, "10s"},
+		{"--dist-file", path, "--backoff"},
+		{"--dist-file", bad},
+		{"--dist-file", empty},
+		{"--dist-file", filepath.Join(t.TempDir(), "missing")},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+func TestRunChoices(t *testing.T) {
+	choices := []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+	for _, jitterArgs := range [][]string{{}, {"-j", "10%"}} {
+		t.Run(strings.Join(append([]string{"jitter"}, jitterArgs...), " "), func(t *testing.T) {
+			args := slices.Concat([]string{"--seed", "11", "--choices", "1s, 5s,30s"}, jitterArgs)
+			opts, err := parseArgs(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			samples, err := drawSamples(opts, 1000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[time.Duration]int)
+			for _, d := range samples {
+				i := slices.IndexFunc(choices, func(c time.Duration) bool {
+					return d >= c-c/10 && d <= c+c/10
+				})
+				if i < 0 {
+					t.Fatalf("draw %v isn't one of %v (±10%%)", d, choices)
+				}
+				if len(jitterArgs) == 0 && d != choices[i] {
+					t.Fatalf("unjittered draw %v isn't exactly one of %v", d, choices)
+				}
+				seen[choices[i]]++
+			}
+			for _, c := range choices {
+				if seen[c] < 250 {
+					t.Errorf("%v drawn %d times of 1000, want about a third", c, seen[c])
+				}
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "latencies")
+	if err := os.WriteFile(path, []byte("1s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"--choices", "1s,soon"},
+		{"--choices", "1s,,2s"},
+		{"--choices", "1s,-2s"},
+		{"--choices", "1s,2s", "10s"},
+		{"--choices", "1s,2s", "--dist-file", path},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+// failingSource is a jitter.Source whose every draw fails.
+type failingSource struct{}
+
+func (failingSource) Uint64n(uint64) (uint64, error) {
+	return 0, errors.New("entropy pool on fire")
+}
+
+func TestRunHooks(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "order")
+	write := func(word string) string { return fmt.Sprintf("echo %s >> '%s'", word, marker) }
+	readMarker := func() string {
+		data, err := os.ReadFile(marker)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return strings.Join(strings.Fields(string(data)), " ")
+	}
+
+	t.Run("order", func(t *testing.T) {
+		os.Remove(marker)
+		args := []string{"--pre-exec", write("pre"), "--post-exec", write("post"), "--count", "2", "1ms"}
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); err != nil {
+			t.Fatalf("run(%v): %v", args, err)
+		}
+		if got, want := readMarker(), "pre post pre post"; got != want {
+			t.Errorf("hooks ran as %q, want %q", got, want)
+		}
+	})
+
+	t.Run("pre-exec failure aborts", func(t *testing.T) {
+		os.Remove(marker)
+		args := []string{"--pre-exec", "exit 3", "--post-exec", write("post"), "1ms"}
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); exitCode(err) == exitOK {
+			t.Fatalf("run(%v) = %v, want a failure", args, err)
+		}
+		if got := readMarker(); got != "" {
+			t.Errorf("post-exec ran after a failed pre-exec: %q", got)
+		}
+	})
+
+	t.Run("post-exec failure", func(t *testing.T) {
+		os.Remove(marker)
+		args := []string{"--pre-exec", write("pre"), "--post-exec", "exit 3", "1ms"}
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); exitCode(err) == exitOK {
+			t.Fatalf("run(%v) = %v, want a failure", args, err)
+		}
+		if got := readMarker(); got != "pre" {
+			t.Errorf("hooks ran as %q, want just pre", got)
+		}
+	})
+
+	t.Run("dry run skips hooks", func(t *testing.T) {
+		os.Remove(marker)
+		args := []string{"-n", "--pre-exec", write("pre"), "--post-exec", write("post"), "1ms"}
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); err != nil {
+			t.Fatalf("run(%v): %v", args, err)
+		}
+		if got := readMarker(); got != "" {
+			t.Errorf("dry run ran hooks: %q", got)
+		}
+	})
+}
+
+func TestRunProbability(t *testing.T) {
+	const runs = 1000
+	var stdout, stderr bytes.Buffer
+	args := []string{"-v", "--seed", "7", "--probability", "30%", "--count", fmt.Sprint(runs), "--fixed", "1ns"}
+	if err := run(args, &stdout, &stderr); err != nil {
+		t.Fatalf("run(%v): %v", args, err)
+	}
+
+	out := stderr.String()
+	if got := strings.Count(out, "sleeping for "); got != runs {
+		t.Errorf("got %d intended durations, want all %d even when skipped", got, runs)
+	}
+	slept, skipped := strings.Count(out, "chosen="), strings.Count(out, "skipped sleep")
+	if slept+skipped != runs {
+		t.Fatalf("slept %d and skipped %d times, want %d in total", slept, skipped, runs)
+	}
+	// The standard deviation of the count is about 14.5.
+	if slept < 250 || slept > 350 {
+		t.Errorf("slept %d of %d times, want about 30%%", slept, runs)
+	}
+
+	for _, p := range []string{"-1%", "101%", "half"} {
+		if _, err := parseArgs([]string{"--probability", p, "10s"}); err == nil {
+			t.Errorf("parseArgs(--probability %s) succeeded, want error", p)
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	runTests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"success", []string{"-n", "10s"}, exitOK},
+		{"unknown flag", []string{"--bogus", "10s"}, exitUsage},
+		{"bad jitter", []string{"-j", "abc", "10s"}, exitUsage},
+		{"missing duration", []string{}, exitUsage},
+		{"bad sample count", []string{"sample", "-n", "0", "10s"}, exitUsage},
+		{"strict warn-above", []string{"--warn-above", "1s", "--strict", "1m"}, exitFailure},
+	}
+
+	for _, tt := range runTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := runMain(tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("runMain(%v) = %d, want %d (stderr %q)", tt.args, got, tt.want, stderr.String())
+			}
+			if hasError := strings.Contains(stderr.String(), "jsleep: "); hasError != (tt.want != exitOK) {
+				t.Errorf("runMain(%v) stderr = %q", tt.args, stderr.String())
+			}
+		})
+	}
+
+	_, _, emptyErr := jitter.Clamp(10*time.Second, 5*time.Second, jitter.Options{})
+	_, randErr := jitter.ChooseSleepDuration(0, time.Second, jitter.Uniform, failingSource{})
+	errTests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, exitOK},
+		{"help", flag.ErrHelp, exitOK},
+		{"interrupted", errInterrupted, exitInterrupted},
+		{"empty interval", usageError{emptyErr}, exitEmptyInterval},
+		{"randomness", randErr, exitRandomness},
+		{"other", errors.New("boom"), exitFailure},
+	}
+	for _, tt := range errTests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%s: %v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestBucketOf(t *testing.T) {
+	low, high := 10*time.Second, 20*time.Second
+	tests := []struct {
+		d    time.Duration
+		n    int
+		want int
+	}{
+		{10 * time.Second, 4, 1},
+		{12499 * time.Millisecond, 4, 1},
+		{12500 * time.Millisecond, 4, 2},
+		{17 * time.Second, 4, 3},
+		{19999 * time.Millisecond, 4, 4},
+		{20 * time.Second, 4, 4},
+		{15 * time.Second, 1, 1},
+		{20 * time.Second, 255, 255},
+	}
+	for _, tt := range tests {
+		if got := bucketOf(tt.d, low, high, tt.n); got != tt.want {
+			t.Errorf("bucketOf(%v, [%v, %v], %d) = %d, want %d", tt.d, low, high, tt.n, got, tt.want)
+		}
+	}
+	if got := bucketOf(5*time.Second, 5*time.Second, 5*time.Second, 10); got != 1 {
+		t.Errorf("bucketOf on an empty-width interval = %d, want 1", got)
+	}
+}
+
+func TestRunExitBucket(t *testing.T) {
+	seen := make(map[int]bool)
+	for seed := 1; seed <= 20; seed++ {
+		args := []string{"-n", "--json", "--seed", fmt.Sprint(seed), "--min", "0s", "--max", "10s", "--exit-bucket", "10"}
+		var stdout, stderr bytes.Buffer
+		code := runMain(args, &stdout, &stderr)
+
+		var report sleepReport
+		if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+			t.Fatalf("runMain(%v) output %q: %v", args, stdout.String(), err)
+		}
+		want := exitBucketBase + min(int(time.Duration(report.ChosenNs)/time.Second)+1, 10)
+		if code != want {
+			t.Errorf("seed %d chose %s, exit status %d, want bucket %d", seed, report.Chosen, code, want)
+		}
+		if strings.Contains(stderr.String(), "jsleep: ") {
+			t.Errorf("seed %d: bucket reported as an error: %q", seed, stderr.String())
+		}
+		seen[code] = true
+	}
+	if len(seen) < 3 {
+		t.Errorf("20 seeds only reached buckets %v", seen)
+	}
+
+	for _, args := range [][]string{
+		{"--exit-bucket", "0", "10s"},
+		{"--exit-bucket", "116", "10s"},
+		{"--exit-bucket", "4", "10s", "--", "true"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
+
+// parseStats parses writeStats output into durations keyed by metric.
+func parseStats(t *testing.T, out string) map[string]time.Duration {
+	t.Helper()
+	stats := make(map[string]time.Duration)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			t.Fatalf("malformed stats line %q", line)
+		}
+		if key == "count" {
+			continue
+		}
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			t.Fatalf("stats line %q: %v", line, err)
+		}
+		stats[key] = d
+	}
+	return stats
+}
+
+func TestRunStats(t *testing.T) {
+	t.Run("equal bounds", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if err := run([]string{"--stats", "50", "-j", "0%", "10s"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		stats := parseStats(t, stdout.String())
+		for _, key := range []string{"min", "max", "mean", "median", "p50", "p90", "p99"} {
+			if got, ok := stats[key]; !ok || got != 10*time.Second {
+				t.Errorf("%s = %v (present %v), want 10s", key, got, ok)
+			}
+		}
+	})
+
+	t.Run("even count", func(t *testing.T) {
+		var stdout bytes.Buffer
+		writeStats(&stdout, []time.Duration{4 * time.Second, time.Second, 3 * time.Second, 2 * time.Second}, "go")
+		stats := parseStats(t, stdout.String())
+		if stats["median"] != 2*time.Second || stats["p50"] != 2*time.Second {
+			t.Errorf("median = %v, p50 = %v; want both 2s", stats["median"], stats["p50"])
+		}
+
+		stdout.Reset()
+		if err := run([]string{"--stats", "1000", "--seed", "1", "--min", "0s", "--max", "10s"}, &stdout, new(bytes.Buffer)); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		stats = parseStats(t, stdout.String())
+		if stats["median"] != stats["p50"] {
+			t.Errorf("median = %v, p50 = %v; want them equal", stats["median"], stats["p50"])
+		}
+	})
+
+	t.Run("wide uniform", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if err := run([]string{"--stats", "20000", "--min", "0s", "--max", "10s"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		stats := parseStats(t, stdout.String())
+		if mean := stats["mean"]; (mean - 5*time.Second).Abs() > 100*time.Millisecond {
+			t.Errorf("mean = %v, want within 100ms of 5s", mean)
+		}
+		if !(stats["min"] <= stats["p50"] && stats["p50"] <= stats["p90"] && stats["p90"] <= stats["p99"] && stats["p99"] <= stats["max"]) {
+			t.Errorf("percentiles out of order: %v", stats)
+		}
+	})
+}
+
+func TestHistogram(t *testing.T) {
+	t.Run("uniform is balanced", func(t *testing.T) {
+		opts, err := parseArgs([]string{"-s", "1", "10s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		const n = 20000
+		samples, err := drawSamples(opts, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts := histogram(samples, opts.low, opts.high, histBins)
+		if len(counts) != histBins {
+			t.Fatalf("got %d bins, want %d", len(counts), histBins)
+		}
+		want := n / histBins
+		for i, c := range counts {
+			if c < want*8/10 || c > want*12/10 {
+				t.Errorf("bin %d has %d samples, want about %d", i, c, want)
+			}
+		}
+	})
+
+	t.Run("equal samples", func(t *testing.T) {
+		samples := []time.Duration{time.Second, time.Second, time.Second}
+		counts := histogram(samples, time.Second, time.Second, histBins)
+		if !slices.Equal(counts, []int{3}) {
+			t.Errorf("histogram = %v, want [3]", counts)
+		}
+
+		var buf bytes.Buffer
+		writeHistogram(&buf, counts, time.Second, time.Second, 40)
+		if got := strings.Count(buf.String(), "\n"); got != 1 {
+			t.Errorf("writeHistogram printed %d lines, want 1:\n%s", got, buf.String())
+		}
+	})
+
+	t.Run("fits width", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		t.Setenv("COLUMNS", "50")
+		if err := run([]string{"--hist", "1000", "10s"}, &stdout, &stderr); err != nil {
+			t.Fatalf("run: %v", err)
+		}
+		lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+		if len(lines) != histBins {
+			t.Fatalf("got %d lines, want %d:\n%s", len(lines), histBins, stdout.String())
+		}
+		for _, line := range lines {
+			if len(line) > 50 {
+				t.Errorf("line wider than 50 columns: %q", line)
+			}
+		}
+	})
+
+	t.Run("conflicts with stats", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--hist", "10", "--stats", "10", "10s"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i + 1)
+	}
+	for _, tt := range []struct{ p, want int }{{50, 50}, {90, 90}, {99, 99}, {100, 100}, {0, 1}} {
+		if got := percentile(sorted, tt.p); got != time.Duration(tt.want) {
+			t.Errorf("percentile(%d) = %d, want %d", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestRunMaxTotal(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantSlept []time.Duration
+	}{
+		{
+			name:      "truncates last iteration",
+			args:      []string{"--count", "inf", "--max-total", "25s", "-j", "0%", "10s"},
+			wantSlept: []time.Duration{10 * time.Second, 10 * time.Second, 5 * time.Second},
+		},
+		{
+			name:      "exact fit",
+			args:      []string{"--count", "inf", "--max-total", "20s", "-j", "0%", "10s"},
+			wantSlept: []time.Duration{10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:      "count ends first",
+			args:      []string{"--count", "2", "--max-total", "1h", "-j", "0%", "10s"},
+			wantSlept: []time.Duration{10 * time.Second, 10 * time.Second},
+		},
+		{
+			name:      "budget below first draw",
+			args:      []string{"--max-total", "3s", "-j", "0%", "10s"},
+			wantSlept: []time.Duration{3 * time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-n", "--json"}, tt.args...)
+			if err := run(args, &stdout, &stderr); err != nil {
+				t.Fatalf("run(%v): %v", args, err)
+			}
+
+			var got []time.Duration
+			dec := json.NewDecoder(&stdout)
+			for dec.More() {
+				var report sleepReport
+				if err := dec.Decode(&report); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if report.ChosenNs < report.LowNs || report.ChosenNs > report.HighNs {
+					t.Errorf("chosen_ns %d outside [%d, %d]", report.ChosenNs, report.LowNs, report.HighNs)
+				}
+				slept := report.ChosenNs
+				if report.TruncatedNs != nil {
+					slept = *report.TruncatedNs
+				}
+				got = append(got, time.Duration(slept))
+			}
+			if !slices.Equal(got, tt.wantSlept) {
+				t.Errorf("slept = %v, want %v", got, tt.wantSlept)
+			}
+			if n := strings.Count(stderr.String(), "budget remaining:"); n != len(tt.wantSlept) {
+				t.Errorf("printed %d budget lines, want %d:\n%s", n, len(tt.wantSlept), stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jsleep.log")
+	if err := os.WriteFile(path, []byte("existing line\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"--count", "3", "--log-file", path, "-j", "0%", "1ms"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Errorf("unexpected output: stdout=%q stderr=%q", stdout.String(), stderr.String())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 || lines[0] != "existing line" {
+		t.Fatalf("log file = %q, want the existing line plus 3 entries", data)
+	}
+	for _, line := range lines[1:] {
+		stamp, rest, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+			t.Errorf("line %q: bad timestamp: %v", line, err)
+		}
+		if want := "chosen=1ms range=[1ms,1ms]"; rest != want {
+			t.Errorf("line %q: got %q, want %q", line, rest, want)
+		}
+	}
+}
+
+func TestRunQuiet(t *testing.T) {
+	tests := [][]string{
+		{"-q", "-v", "1ms"},
+		{"--quiet", "--json", "--countdown", "1ms"},
+		{"-q", "-n", "-v", "--json", "-j", "200%", "10s"},
+		{"-q", "-n", "--count", "3", "--max-total", "25s", "10s"},
+		{"-q", "--stats", "10", "10s"},
+	}
+
+	for _, args := range tests {
+		t.Run(strings.Join(args, "_"), func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(args, &stdout, &stderr); err != nil {
+				t.Fatalf("run(%v): %v", args, err)
+			}
+			if stdout.Len() != 0 || stderr.Len() != 0 {
+				t.Errorf("run(%v) wrote stdout=%q stderr=%q, want nothing", args, stdout.String(), stderr.String())
+			}
+		})
+	}
+
+	t.Run("errors still reported", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if err := run([]string{"-q", "--min", "10s", "--max", "5s"}, &stdout, &stderr); err == nil {
+			t.Error("expected an error")
+		}
+	})
 }
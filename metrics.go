@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeMetrics replaces the file at path with gauges for the last sleep in
+// Prometheus text exposition format, as read by node_exporter's textfile
+// collector. The file is written to a temporary name and renamed into place
+// so a scrape never sees it half written.
+func writeMetrics(path string, low, high, chosen time.Duration) error {
+	var b strings.Builder
+	for _, m := range []struct {
+		name, help string
+		value      time.Duration
+	}{
+		{"jsleep_chosen_seconds", "Duration jsleep chose to sleep.", chosen},
+		{"jsleep_low_seconds", "Low end of the interval jsleep sampled from.", low},
+		{"jsleep_high_seconds", "High end of the interval jsleep sampled from.", high},
+	} {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n",
+			m.name, m.help, m.name, m.name, strconv.FormatFloat(m.value.Seconds(), 'g', -1, 64))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRunMetricsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jsleep.prom")
+	if err := os.WriteFile(path, []byte("stale\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"--metrics-file", path, "-n", "--count", "2", "10s"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	types := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if rest, ok := strings.CutPrefix(line, "# TYPE "); ok {
+			name, typ, _ := strings.Cut(rest, " ")
+			types[name] = typ
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, val, ok := strings.Cut(line, " ")
+		if !ok {
+			t.Fatalf("malformed sample line %q", line)
+		}
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			t.Fatalf("sample line %q: %v", line, err)
+		}
+		values[name] = v
+	}
+
+	for _, name := range []string{"jsleep_chosen_seconds", "jsleep_low_seconds", "jsleep_high_seconds"} {
+		if _, ok := values[name]; !ok || types[name] != "gauge" {
+			t.Errorf("missing gauge %s in:\n%s", name, data)
+		}
+	}
+	if values["jsleep_low_seconds"] != 5 || values["jsleep_high_seconds"] != 15 {
+		t.Errorf("bounds = [%v, %v], want [5, 15]", values["jsleep_low_seconds"], values["jsleep_high_seconds"])
+	}
+	if c := values["jsleep_chosen_seconds"]; c < 5 || c > 15 {
+		t.Errorf("jsleep_chosen_seconds = %v, want in [5, 15]", c)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
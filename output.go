@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/thomasdesr/jsleep/jitter"
+)
+
+// formatFields are the values a --format template can use.
+type formatFields struct {
+	Chosen    time.Duration // rounded to the millisecond, as in "sleeping for"
+	Low, High time.Duration
+	Unix      int64 // when the sleep starts, in seconds since the epoch
+}
+
+// writeVerbose writes the line -v prints for the i-th sleep of chosen within
+// [low, high]: the --format line if there is one, or else "sleeping for".
+func writeVerbose(w io.Writer, opts options, colors palette, i int, low, high, chosen time.Duration) error {
+	if opts.format != nil {
+		return writeFormat(w, opts.format, low, high, chosen)
+	}
+	label, value := colors.dim("sleeping for"), colors.bright(verboseDuration(opts, chosen))
+	var err error
+	switch opts.count {
+	case 1:
+		_, err = fmt.Fprintf(w, "%s %s\n", label, value)
+	case 0:
+		_, err = fmt.Fprintf(w, "%s %s (iteration %d)\n", label, value, i)
+	default:
+		_, err = fmt.Fprintf(w, "%s %s (iteration %d of %d)\n", label, value, i, opts.count)
+	}
+	return err
+}
+
+// writeDetail writes what -vv and -vvv add under the verbose line: the
+// interval and distribution, and at -vvv the random source, how many values
+// were asked of it for the sleep, and how many raw draws it made for them,
+// counting the ones it rejected to avoid bias.
+func writeDetail(w io.Writer, opts options, low, high time.Duration, draws *countingSource) {
+	fmt.Fprintf(w, "  interval [%s, %s] dist %s\n", formatDuration(low, opts.durationFormat), formatDuration(high, opts.durationFormat), opts.dist)
+	if draws != nil {
+		fmt.Fprintf(w, "  rng %s values %d attempts %d\n", opts.rngName, draws.n, draws.attempts)
+	}
+}
+
+// countingSource counts the values asked of Source, and the raw draws Source
+// made for them, since both were last reset. Use newCountingSource so the
+// draws are counted.
+type countingSource struct {
+	jitter.Source
+	n        int
+	attempts uint64
+}
+
+// newCountingSource wraps src in a countingSource, pointing the Attempts of
+// any jitter source at its attempts.
+func newCountingSource(src jitter.Source) *countingSource {
+	s := new(countingSource)
+	switch src := src.(type) {
+	case jitter.CryptoSource:
+		src.Attempts = &s.attempts
+		s.Source = src
+	case *jitter.SeededSource:
+		src.Attempts = &s.attempts
+		s.Source = src
+	case *jitter.PCGSource:
+		src.Attempts = &s.attempts
+		s.Source = src
+	default:
+		s.Source = src
+	}
+	return s
+}
+
+func (s *countingSource) Uint64n(n uint64) (uint64, error) {
+	s.n++
+	return s.Source.Uint64n(n)
+}
+
+// reset zeroes both counts.
+func (s *countingSource) reset() {
+	s.n, s.attempts = 0, 0
+}
+
+// writeFormat writes the --format line for a sleep of chosen within
+// [low, high], adding a trailing newline if the template has none.
+func writeFormat(w io.Writer, tmpl *template.Template, low, high, chosen time.Duration) error {
+	var b strings.Builder
+	err := tmpl.Execute(&b, formatFields{
+		Chosen: chosen.Round(time.Millisecond),
+		Low:    low,
+		High:   high,
+		Unix:   now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	line := b.String()
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	_, err = io.WriteString(w, line)
+	return err
+}
+
+// sleepReport is the --json output.
+type sleepReport struct {
+	LowNs    int64  `json:"low_ns"`
+	HighNs   int64  `json:"high_ns"`
+	ChosenNs int64  `json:"chosen_ns"`
+	Chosen   string `json:"chosen"`
+	// TruncatedNs is how long jsleep actually slept when --max-total or
+	// --deadline cut the chosen duration short, and absent otherwise.
+	TruncatedNs *int64 `json:"truncated_ns,omitempty"`
+}
+
+// interruptReport is the --report-json-on-signal output.
+type interruptReport struct {
+	ChosenNs    int64 `json:"chosen_ns"`
+	ElapsedNs   int64 `json:"elapsed_ns"`
+	Interrupted bool  `json:"interrupted"`
+}
+
+// writeInterruptJSON writes how long of the chosen sleep passed before a
+// signal cut it short to w as a single line of JSON.
+func writeInterruptJSON(w io.Writer, chosen, elapsed time.Duration) error {
+	return json.NewEncoder(w).Encode(interruptReport{
+		ChosenNs:    int64(chosen),
+		ElapsedNs:   int64(elapsed),
+		Interrupted: true,
+	})
+}
+
+// writeJSON writes the sampled interval and chosen duration to w as a single
+// line of JSON, along with the sleep actually taken if that is shorter.
+func writeJSON(w io.Writer, low, high, chosen, slept time.Duration, style string) error {
+	report := sleepReport{
+		LowNs:    int64(low),
+		HighNs:   int64(high),
+		ChosenNs: int64(chosen),
+		Chosen:   formatDuration(chosen, style),
+	}
+	if slept < chosen {
+		ns := int64(slept)
+		report.TruncatedNs = &ns
+	}
+	return json.NewEncoder(w).Encode(report)
+}
+
+// formatDuration formats d in a --duration-format style: "go" (or "") for
+// Go's own notation, as in 1m30.5s; "ns" for a bare count of nanoseconds;
+// or "human" for words, as in "1 minute 30.5 seconds".
+func formatDuration(d time.Duration, style string) string {
+	switch style {
+	case "ns":
+		return strconv.FormatInt(int64(d), 10)
+	case "human":
+		return humanDuration(d)
+	}
+	return d.String()
+}
+
+// humanDuration spells d out in hours, minutes, and seconds, or in the
+// largest unit below a second that it reaches.
+func humanDuration(d time.Duration) string {
+	if d < 0 && d != math.MinInt64 {
+		return "-" + humanDuration(-d)
+	}
+	unit := func(v float64, name string) string {
+		s := strconv.FormatFloat(v, 'f', -1, 64) + " " + name
+		if v != 1 {
+			s += "s"
+		}
+		return s
+	}
+	switch {
+	case d == 0:
+		return "0 seconds"
+	case d < time.Microsecond:
+		return unit(float64(d), "nanosecond")
+	case d < time.Millisecond:
+		return unit(float64(d)/float64(time.Microsecond), "microsecond")
+	case d < time.Second:
+		return unit(float64(d)/float64(time.Millisecond), "millisecond")
+	}
+
+	var parts []string
+	if h := d / time.Hour; h > 0 {
+		parts = append(parts, unit(float64(h), "hour"))
+		d -= h * time.Hour
+	}
+	if m := d / time.Minute; m > 0 {
+		parts = append(parts, unit(float64(m), "minute"))
+		d -= m * time.Minute
+	}
+	if d > 0 {
+		parts = append(parts, unit(d.Seconds(), "second"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// verboseDuration formats d for verbose output, rounded to the
+// millisecond unless --duration-format asks for something else.
+func verboseDuration(opts options, d time.Duration) string {
+	if opts.durationFormat == "" {
+		return d.Round(time.Millisecond).String()
+	}
+	return formatDuration(d, opts.durationFormat)
+}
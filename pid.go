@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Ways --pid-mode combines the sleep with waiting for --pid-wait's process.
+const (
+	pidLater   = "later"   // return once the sleep is over and the process has exited
+	pidEarlier = "earlier" // return at whichever happens first
+)
+
+// pidPollInterval is how often sleepPid checks whether the process is still
+// running.
+var pidPollInterval = 100 * time.Millisecond
+
+// sleepPid sleeps for d while polling pid, returning at the later or earlier
+// of the two ends as mode says. It returns false if interrupt fires first.
+func sleepPid(d time.Duration, pid int, mode string, interrupt <-chan os.Signal) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(pidPollInterval)
+	defer ticker.Stop()
+
+	slept, exited := false, !processAlive(pid)
+	for {
+		if (mode == pidEarlier && (slept || exited)) || (slept && exited) {
+			return true
+		}
+		select {
+		case <-timer.C:
+			slept = true
+		case <-ticker.C:
+			exited = exited || !processAlive(pid)
+		case <-interrupt:
+			return false
+		}
+	}
+}
@@ -0,0 +1,86 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// startChild starts a process that exits after d and reaps it when it does.
+func startChild(t *testing.T, d time.Duration) int {
+	t.Helper()
+	cmd := exec.Command("sleep", fmt.Sprint(d.Seconds()))
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		<-done
+	})
+	return cmd.Process.Pid
+}
+
+func TestRunPidWait(t *testing.T) {
+	pidPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { pidPollInterval = 100 * time.Millisecond })
+
+	const child = 300 * time.Millisecond
+	tests := []struct {
+		name     string
+		args     []string
+		min, max time.Duration
+	}{
+		{"later waits for the process", []string{"--fixed", "10ms"}, child, 5 * time.Second},
+		{"later waits for the sleep", []string{"--fixed", "600ms"}, 600 * time.Millisecond, 5 * time.Second},
+		{"earlier returns when the process exits", []string{"--pid-mode", "earlier", "1h"}, child, 5 * time.Second},
+		{"earlier returns when the sleep ends", []string{"--pid-mode", "earlier", "--fixed", "10ms"}, 10 * time.Millisecond, child},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--pid-wait", fmt.Sprint(startChild(t, child))}, tt.args...)
+			start := time.Now()
+			if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); err != nil {
+				t.Fatalf("run(%v): %v", args, err)
+			}
+			if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("run(%v) took %v, want between %v and %v", args, elapsed, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestParseArgsPidWait(t *testing.T) {
+	// Find a pid that isn't running by starting a child and reaping it.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	gone := fmt.Sprint(cmd.Process.Pid)
+
+	for _, args := range [][]string{
+		{"--pid-wait", gone, "10s"},
+		{"--pid-wait", "0", "10s"},
+		{"--pid-wait", "-1", "10s"},
+		{"--pid-wait", "1", "--pid-mode", "sooner", "10s"},
+		{"--pid-mode", "earlier", "10s"},
+	} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+
+	// pid 1 always exists, and unless we're root we may not signal it.
+	if _, err := parseArgs([]string{"--pid-wait", "1", "10s"}); err != nil {
+		t.Errorf("parseArgs(--pid-wait 1): %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// processAlive reports whether pid is still running. Without signal 0 there
+// is no way to tell, so checkProcess rules --pid-wait out first.
+func processAlive(pid int) bool {
+	return false
+}
+
+// checkProcess returns an error explaining why pid can't be waited for.
+func checkProcess(pid int) error {
+	return errors.New("--pid-wait is not supported on this platform")
+}
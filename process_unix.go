@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// processAlive reports whether pid is still running, by sending it signal 0.
+// A process that exists but that we aren't allowed to signal counts as
+// running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// checkProcess returns an error explaining why pid can't be waited for, if
+// it can't.
+func checkProcess(pid int) error {
+	switch err := syscall.Kill(pid, 0); {
+	case err == nil:
+		return nil
+	case errors.Is(err, syscall.EPERM):
+		// It exists; signal 0 is all we'll ever send, so that's enough.
+		return nil
+	case errors.Is(err, syscall.ESRCH):
+		return fmt.Errorf("no such process: %d", pid)
+	default:
+		return fmt.Errorf("checking process %d: %w", pid, err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyContinue returns a channel that never fires: there is no SIGCONT
+// here.
+var notifyContinue = func() (<-chan os.Signal, func()) {
+	return nil, func() {}
+}
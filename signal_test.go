@@ -0,0 +1,47 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunReportJSONOnSignal(t *testing.T) {
+	// Catch SIGINT for the whole test too, so one that lands before run
+	// starts listening can't kill the test binary.
+	caught := make(chan os.Signal, 1)
+	signal.Notify(caught, os.Interrupt)
+	defer signal.Stop(caught)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+
+	var stdout bytes.Buffer
+	err := run([]string{"--report-json-on-signal", "-j", "0%", "10s"}, &stdout, new(bytes.Buffer))
+	if exitCode(err) != exitInterrupted {
+		t.Fatalf("run = %v, want an interruption", err)
+	}
+
+	var got interruptReport
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", stdout.String(), err)
+	}
+	if !got.Interrupted || got.ChosenNs != int64(10*time.Second) {
+		t.Errorf("report = %+v, want interrupted with chosen_ns 10s", got)
+	}
+	if got.ElapsedNs <= 0 || got.ElapsedNs >= got.ChosenNs {
+		t.Errorf("elapsed_ns = %d, want it in (0, %d)", got.ElapsedNs, got.ChosenNs)
+	}
+
+	if _, err := parseArgs([]string{"--report-json-on-signal", "--ignore-signals", "10s"}); err == nil {
+		t.Error("parseArgs with --ignore-signals succeeded, want error")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyContinue returns a channel that receives SIGCONT whenever jsleep is
+// continued after being stopped, as by Ctrl-Z and fg, and a func that stops
+// the notifications. It is swapped out in tests.
+var notifyContinue = func() (<-chan os.Signal, func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGCONT)
+	return c, func() { signal.Stop(c) }
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// resumeState implements --state-file for a sleep of d starting at t. If
+// the file at path holds a wake time after t, a previous run was cut short
+// and only what it had left is slept; otherwise the wake time t+d is
+// written there and d is returned unchanged. A wake time that has already
+// passed is stale and is replaced.
+func resumeState(path string, d time.Duration, t time.Time) (time.Duration, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return 0, err
+	default:
+		wake, perr := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+		if perr != nil {
+			return 0, fmt.Errorf("--state-file %s: invalid wake time: %w", path, perr)
+		}
+		if wake.After(t) {
+			return wake.Sub(t), nil
+		}
+	}
+
+	wake := t.Add(d).Format(time.RFC3339Nano) + "\n"
+	if err := os.WriteFile(path, []byte(wake), 0o644); err != nil {
+		return 0, err
+	}
+	return d, nil
+}
+
+// clearState removes the --state-file once its sleep is over, so the next
+// run starts a fresh one.
+func clearState(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
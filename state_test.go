@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResumeState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jsleep.state")
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// The first run records its wake time and sleeps the whole duration.
+	if got, err := resumeState(path, 10*time.Second, start); err != nil || got != 10*time.Second {
+		t.Fatalf("first run = %s, %v; want 10s", got, err)
+	}
+
+	// A restart 3s in, even with a different draw, sleeps only what is left.
+	if got, err := resumeState(path, time.Minute, start.Add(3*time.Second)); err != nil || got != 7*time.Second {
+		t.Fatalf("restart = %s, %v; want 7s", got, err)
+	}
+
+	// Once the wake time has passed the file is stale and a new sleep starts.
+	later := start.Add(time.Hour)
+	if got, err := resumeState(path, 5*time.Second, later); err != nil || got != 5*time.Second {
+		t.Fatalf("stale restart = %s, %v; want 5s", got, err)
+	}
+	if got, err := resumeState(path, time.Minute, later.Add(time.Second)); err != nil || got != 4*time.Second {
+		t.Fatalf("restart after stale = %s, %v; want 4s", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte("soon\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resumeState(path, time.Second, start); err == nil {
+		t.Error("resumeState accepted a garbled state file")
+	}
+}
+
+func TestRunStateFile(t *testing.T) {
+	ref := time.Now()
+	now = func() time.Time { return ref }
+	t.Cleanup(func() { now = time.Now })
+
+	path := filepath.Join(t.TempDir(), "jsleep.state")
+	wake := ref.Add(20 * time.Millisecond).Format(time.RFC3339Nano)
+	if err := os.WriteFile(path, []byte(wake+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"--json", "--state-file", path, "10s"}, &stdout, new(bytes.Buffer)); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	var got sleepReport
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if chosen := time.Duration(got.ChosenNs); chosen != 20*time.Millisecond {
+		t.Errorf("resumed sleep chose %s, want the 20ms left", chosen)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state file still there after the sleep: %v", err)
+	}
+
+	for _, args := range [][]string{{"--state-file", path, "--count", "2", "10s"}, {"--state-file", path, "--jobs", "2", "10s"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("parseArgs(%v) succeeded, want error", args)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runStream implements "jsleep stream": it takes the usual options plus
+// --rate <per-second> anywhere among them, and prints sampled durations to
+// stdout, one per line, until interrupted. Without --rate it draws as fast as
+// the output is read.
+func runStream(args []string, stdout io.Writer) error {
+	var rate float64
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		val, ok := strings.CutPrefix(arg, "--rate=")
+		if !ok && arg != "--rate" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !ok {
+			if i+1 == len(args) {
+				return usageError{errors.New("stream: --rate requires a number of draws per second")}
+			}
+			i++
+			val = args[i]
+		}
+		r, err := strconv.ParseFloat(val, 64)
+		if err != nil || !(r > 0) || r > float64(time.Second) {
+			return usageError{fmt.Errorf("stream: invalid rate: %s", val)}
+		}
+		rate = r
+	}
+
+	opts, err := parseArgs(rest)
+	if err != nil {
+		return usageError{err}
+	}
+	if len(opts.command) > 0 {
+		return usageError{errors.New("stream: cannot run a command")}
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+	return streamSamples(stdout, opts, rate, stop)
+}
+
+// streamSamples writes one sampled duration per line to w until stop
+// receives, or at most rate lines a second when rate is positive. Each line
+// is a separate write, so nothing sits in a buffer while the stream idles.
+func streamSamples(w io.Writer, opts options, rate float64, stop <-chan os.Signal) error {
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		samples, err := drawSamples(opts, 1)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, formatDuration(samples[0], opts.durationFormat)); err != nil {
+			return err
+		}
+
+		if tick == nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			continue
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-tick:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStreamSamples(t *testing.T) {
+	for _, rate := range []float64{0, 1000} {
+		opts, err := parseArgs([]string{"-j", "50%", "10s"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, w := io.Pipe()
+		stop := make(chan os.Signal, 1)
+		done := make(chan error, 1)
+		go func() {
+			err := streamSamples(w, opts, rate, stop)
+			w.Close()
+			done <- err
+		}()
+
+		sc := bufio.NewScanner(r)
+		for range 5 {
+			if !sc.Scan() {
+				t.Fatalf("rate %g: stream ended early: %v", rate, sc.Err())
+			}
+			d, err := time.ParseDuration(sc.Text())
+			if err != nil {
+				t.Fatalf("rate %g: unparseable sample %q: %v", rate, sc.Text(), err)
+			}
+			if d < 5*time.Second || d > 15*time.Second {
+				t.Errorf("rate %g: sample %s outside [5s, 15s]", rate, d)
+			}
+		}
+
+		stop <- os.Interrupt
+		go io.Copy(io.Discard, r)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("rate %g: streamSamples() = %v after interrupt, want nil", rate, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("rate %g: stream didn't stop after interrupt", rate)
+		}
+	}
+}
+
+func TestRunStreamArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"stream", "10s", "--rate"},
+		{"stream", "--rate", "0", "10s"},
+		{"stream", "--rate=fast", "10s"},
+		{"stream", "10s", "--", "true"},
+	} {
+		if err := run(args, new(bytes.Buffer), new(bytes.Buffer)); exitCode(err) != exitUsage {
+			t.Errorf("run(%v) = %v, want a usage error", args, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunSyslog(t *testing.T) {
+	// Unix socket paths are short, so keep clear of t.TempDir's long names.
+	dir, err := os.MkdirTemp("", "jsleep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	addr := filepath.Join(dir, "log")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	syslogNetwork, syslogAddr = "unixgram", addr
+	t.Cleanup(func() { syslogNetwork, syslogAddr = "", "" })
+
+	var stderr bytes.Buffer
+	if err := run([]string{"--syslog", "--syslog-tag", "poller", "-j", "0%", "1ms"}, new(bytes.Buffer), &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("unexpected stderr without -v: %q", stderr.String())
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("reading syslog message: %v", err)
+	}
+	msg := string(buf[:n])
+	// 14 is INFO (6) in the user facility (1 << 3).
+	for _, want := range []string{"<14>", "poller[", "sleeping for 1ms"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("syslog message %q is missing %q", msg, want)
+		}
+	}
+
+	syslogAddr = filepath.Join(dir, "missing")
+	if err := run([]string{"--syslog", "-n", "1ms"}, new(bytes.Buffer), new(bytes.Buffer)); err == nil || !strings.Contains(err.Error(), "--syslog") {
+		t.Errorf("run with no syslog daemon = %v, want a --syslog error", err)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// syslogNetwork and syslogAddr pick the syslog daemon for --syslog; empty
+// means the local one. They are swapped out in tests.
+var syslogNetwork, syslogAddr string
+
+// openSyslog connects to syslog for --syslog. Every write is logged at INFO
+// priority under tag.
+func openSyslog(tag string) (io.WriteCloser, error) {
+	return syslog.Dial(syslogNetwork, syslogAddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+}